@@ -0,0 +1,41 @@
+package handler
+
+import "strconv"
+
+// BufferLimitError is returned when the host buffers more of a body than its
+// configured limit, for example when FeatureBufferResponse is enabled.
+//
+// Hosts pass this as the error to FuncHandleResponse, so the guest receives
+// `isError=1` and can write a replacement response.
+type BufferLimitError struct {
+	// Kind is the body that exceeded the limit.
+	Kind BodyKind
+
+	// Limit is the maximum bytes that could be buffered.
+	Limit int64
+}
+
+// Error implements error.
+func (e *BufferLimitError) Error() string {
+	kind := "request"
+	if e.Kind == BodyKindResponse {
+		kind = "response"
+	}
+	return kind + " body exceeds buffer limit of " + strconv.FormatInt(e.Limit, 10) + " bytes"
+}
+
+// StatusCodeError is raised when the guest sets a status code outside the
+// range 100-999, or one not allowed by the function, for example
+// FuncSendInformational with 200.
+//
+// Hosts receive this as the error from Middleware.HandleRequest or
+// Middleware.HandleResponse.
+type StatusCodeError struct {
+	// StatusCode is the invalid status code.
+	StatusCode uint32
+}
+
+// Error implements error.
+func (e *StatusCodeError) Error() string {
+	return "invalid status code: " + strconv.FormatUint(uint64(e.StatusCode), 10)
+}
@@ -48,6 +48,51 @@ const (
 	//
 	// See https://peps.python.org/pep-0444/#request-trailers-and-chunked-transfer-encoding
 	FeatureTrailers
+
+	// FeatureStreamResponse calls FuncHandleResponseBody for each chunk of
+	// the HTTP response body produced by FuncNext, instead of buffering it.
+	// This allows the caller to inspect or transform large responses, such as
+	// downloads, with bounded memory.
+	//
+	// Each chunk is sent unchanged unless the guest calls FuncWriteBody with
+	// BodyKindResponse while handling it. The status code and response
+	// headers can be changed until the first call to FuncHandleResponseBody
+	// returns, after which the host sends them.
+	//
+	// Note: FeatureBufferResponse takes precedence when both are enabled. A
+	// guest that doesn't export FuncHandleResponseBody cannot enable this, so
+	// the bit is 0 in the FuncEnableFeatures result.
+	FeatureStreamResponse
+
+	// FeatureStreamRequest calls FuncHandleRequestBody for each chunk of the
+	// HTTP request body as FuncNext reads it, instead of buffering it. This
+	// allows the caller to transform large requests, such as uploads, with
+	// bounded memory.
+	//
+	// Each chunk is passed to FuncNext unchanged unless the guest calls
+	// FuncWriteBody with BodyKindRequest while handling it. The host only
+	// reads more of the request body when FuncNext consumed what the guest
+	// produced so far, so the amount held at once is bounded by the host.
+	//
+	// Note: As the length of the transformed body is unknown, the host
+	// removes any "Content-Length" request header seen by FuncNext. A guest
+	// that doesn't export FuncHandleRequestBody cannot enable this, so the
+	// bit is 0 in the FuncEnableFeatures result.
+	FeatureStreamRequest
+
+	// FeatureDecodeContent decodes HTTP bodies with a "Content-Encoding" of
+	// "gzip" or "deflate" before FuncReadBody, so that the caller sees the
+	// original content instead of compressed bytes.
+	//
+	// FuncWriteBody accepts decoded content in turn. For BodyKindRequest, the
+	// host removes the "Content-Encoding" request header, as FuncNext sees the
+	// body written as-is. For BodyKindResponse, the host encodes the body
+	// written with the same coding before sending it.
+	//
+	// Note: Bodies with any other or multiple codings are left as-is. Chunks
+	// handled with FeatureStreamRequest or FeatureStreamResponse are never
+	// decoded, as a coding spans the whole body.
+	FeatureDecodeContent
 )
 
 // WithEnabled enables the feature or group of features.
@@ -85,6 +130,12 @@ func featureName(f Features) string {
 		return "buffer_response"
 	case FeatureTrailers:
 		return "trailers"
+	case FeatureStreamResponse:
+		return "stream_response"
+	case FeatureStreamRequest:
+		return "stream_request"
+	case FeatureDecodeContent:
+		return "decode_content"
 	}
 	return ""
 }
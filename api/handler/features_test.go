@@ -60,6 +60,9 @@ func TestFeatures_String(t *testing.T) {
 		{name: "buffer_request", feature: FeatureBufferRequest, expected: "buffer_request"},
 		{name: "buffer_response", feature: FeatureBufferResponse, expected: "buffer_response"},
 		{name: "trailers", feature: FeatureTrailers, expected: "trailers"},
+		{name: "stream_response", feature: FeatureStreamResponse, expected: "stream_response"},
+		{name: "stream_request", feature: FeatureStreamRequest, expected: "stream_request"},
+		{name: "decode_content", feature: FeatureDecodeContent, expected: "decode_content"},
 		{name: "all", feature: FeatureBufferRequest | FeatureBufferResponse | FeatureTrailers, expected: "buffer_request|buffer_response|trailers"},
 		{name: "undefined", feature: 1 << 31, expected: ""},
 	}
@@ -26,6 +26,10 @@ type Middleware[H any] interface {
 // These callbacks are used by the guest function export FuncHandleRequest.
 type Host interface {
 	// EnableFeatures supports the WebAssembly function export EnableFeatures.
+	//
+	// When the context is of a request, the result is the features enabled
+	// for it, which may exclude some the host otherwise supports. For
+	// example, a host may not buffer bodies of a protocol upgrade request.
 	EnableFeatures(ctx context.Context, features Features) Features
 
 	// GetMethod supports the WebAssembly function export FuncGetMethod.
@@ -46,6 +50,41 @@ type Host interface {
 	// SetURI supports the WebAssembly function export FuncSetURI.
 	SetURI(ctx context.Context, uri string)
 
+	// GetQueryNames supports the WebAssembly function export
+	// FuncGetQueryNames. This returns nil if the URI has no query parameters.
+	GetQueryNames(ctx context.Context) []string
+
+	// GetQueryValues supports the WebAssembly function export
+	// FuncGetQueryValues. This returns nil if no values exist.
+	GetQueryValues(ctx context.Context, name string) []string
+
+	// SetQueryValue supports the WebAssembly function export
+	// FuncSetQueryValue.
+	SetQueryValue(ctx context.Context, name, value string)
+
+	// AddQueryValue supports the WebAssembly function export
+	// FuncAddQueryValue.
+	AddQueryValue(ctx context.Context, name, value string)
+
+	// RemoveQuery supports the WebAssembly function export FuncRemoveQuery.
+	RemoveQuery(ctx context.Context, name string)
+
+	// GetScheme supports the WebAssembly function export FuncGetScheme.
+	GetScheme(ctx context.Context) string
+
+	// SetScheme supports the WebAssembly function export FuncSetScheme.
+	SetScheme(ctx context.Context, scheme string)
+
+	// GetAuthority supports the WebAssembly function export
+	// FuncGetAuthority. This returns the same value as the "Host" request
+	// header.
+	GetAuthority(ctx context.Context) string
+
+	// SetAuthority supports the WebAssembly function export
+	// FuncSetAuthority. This must have the same effect as setting the "Host"
+	// request header.
+	SetAuthority(ctx context.Context, authority string)
+
 	// GetProtocolVersion supports the WebAssembly function export
 	// FuncGetProtocolVersion.
 	GetProtocolVersion(ctx context.Context) string
@@ -167,6 +206,103 @@ type Host interface {
 	// FuncRemoveHeader with HeaderKindResponseTrailers. This panics if
 	// FeatureTrailers is not supported.
 	RemoveResponseTrailer(ctx context.Context, name string)
+
+	// GetRequestCookieNames supports the WebAssembly function export
+	// FuncGetCookieNames. This returns nil if no cookies exist.
+	GetRequestCookieNames(ctx context.Context) []string
+
+	// GetRequestCookieValues supports the WebAssembly function export
+	// FuncGetCookieValues. This returns nil if no values exist.
+	GetRequestCookieValues(ctx context.Context, name string) []string
+
+	// SetResponseCookie supports the WebAssembly function export
+	// FuncSetCookie.
+	SetResponseCookie(ctx context.Context, cookie Cookie)
+
+	// DeleteResponseCookie supports the WebAssembly function export
+	// FuncDeleteCookie.
+	DeleteResponseCookie(ctx context.Context, name, path, domain string)
+
+	// GetRemoteAddr supports the WebAssembly function export
+	// FuncGetRemoteAddr. This returns empty if the address is unknown.
+	GetRemoteAddr(ctx context.Context) string
+
+	// GetLocalAddr supports the WebAssembly function export
+	// FuncGetLocalAddr. This returns empty if the address is unknown.
+	GetLocalAddr(ctx context.Context) string
+
+	// GetTLSVersion supports the WebAssembly function export
+	// FuncGetTLSVersion. This returns empty if the request isn't over TLS.
+	GetTLSVersion(ctx context.Context) string
+
+	// GetTLSCipherSuite supports the WebAssembly function export
+	// FuncGetTLSCipherSuite. This returns empty if the request isn't over
+	// TLS.
+	GetTLSCipherSuite(ctx context.Context) string
+
+	// GetTLSServerName supports the WebAssembly function export
+	// FuncGetTLSServerName. This returns empty if the request isn't over TLS
+	// or the client didn't indicate a server name.
+	GetTLSServerName(ctx context.Context) string
+
+	// GetTLSPeerSubject supports the WebAssembly function export
+	// FuncGetTLSPeerSubject. This returns empty if the client didn't present
+	// a certificate.
+	GetTLSPeerSubject(ctx context.Context) string
+
+	// GetTLSPeerSANs supports the WebAssembly function export
+	// FuncGetTLSPeerSANs. This returns nil if the client didn't present a
+	// certificate or it has no subject alternative names.
+	GetTLSPeerSANs(ctx context.Context) []string
+}
+
+// InformationalHost is an optional interface a Host implements to support
+// the WebAssembly function export FuncSendInformational.
+type InformationalHost interface {
+	// SendInformational sends an informational (1xx) response with the
+	// current response headers, before the final response. The status code
+	// is between 100 and 199, but not 101.
+	SendInformational(ctx context.Context, statusCode uint32)
+}
+
+// ReasonPhraseHost is an optional interface a Host implements to support
+// the WebAssembly function export FuncSetReasonPhrase.
+//
+// Only hosts which control the HTTP/1.1 status line can implement this, as
+// HTTP/2 and later have no reason phrase.
+type ReasonPhraseHost interface {
+	// SetReasonPhrase overrides the reason phrase sent after the status
+	// code, such as "OK" for 200. An empty reason phrase means the default.
+	SetReasonPhrase(ctx context.Context, reason string)
+}
+
+// BodyBytesHost is an optional interface a Host implements when it can hold
+// bodies in memory. FuncReadBody then copies the body into memory once,
+// instead of through an io.Reader, and FuncBodyLen can return its length.
+//
+// Each function is called at most once per body, instead of the Host's
+// reader. The result is what remains of the body, and the caller does not
+// modify it. It is borrowed, not copied, so the host must not reuse its
+// memory while the request is handled, for example when the guest rewrites
+// the body after reading part of it.
+type BodyBytesHost interface {
+	// RequestBodyBytes returns the request body and true, or false if the
+	// host doesn't hold it in memory.
+	RequestBodyBytes(ctx context.Context) ([]byte, bool)
+
+	// ResponseBodyBytes returns the response body and true, or false if the
+	// host doesn't hold it in memory.
+	ResponseBodyBytes(ctx context.Context) ([]byte, bool)
+}
+
+// ResponseSentHost is an optional interface a Host implements when it can
+// tell whether the response status code and headers were sent, for example
+// after the guest wrote the body without buffering. FuncSendResponse then
+// fails instead of sending a partial response.
+type ResponseSentHost interface {
+	// ResponseHeadersSent returns true if the response status code and
+	// headers were sent, so they can no longer change.
+	ResponseHeadersSent(ctx context.Context) bool
 }
 
 // eofReader is safer than reading from os.DevNull as it can never overrun
@@ -187,6 +323,15 @@ func (UnimplementedHost) GetTemplate(context.Context) string
 func (UnimplementedHost) SetTemplate(context.Context, string)                                {}
 func (UnimplementedHost) GetURI(context.Context) string                                      { return "" }
 func (UnimplementedHost) SetURI(context.Context, string)                                     {}
+func (UnimplementedHost) GetQueryNames(context.Context) (names []string)                     { return }
+func (UnimplementedHost) GetQueryValues(context.Context, string) (values []string)           { return }
+func (UnimplementedHost) SetQueryValue(context.Context, string, string)                      {}
+func (UnimplementedHost) AddQueryValue(context.Context, string, string)                      {}
+func (UnimplementedHost) RemoveQuery(context.Context, string)                                {}
+func (UnimplementedHost) GetScheme(context.Context) string                                   { return "http" }
+func (UnimplementedHost) SetScheme(context.Context, string)                                  {}
+func (UnimplementedHost) GetAuthority(context.Context) string                                { return "" }
+func (UnimplementedHost) SetAuthority(context.Context, string)                               {}
 func (UnimplementedHost) GetProtocolVersion(context.Context) string                          { return "HTTP/1.1" }
 func (UnimplementedHost) GetRequestHeaderNames(context.Context) (names []string)             { return }
 func (UnimplementedHost) GetRequestHeaderValues(context.Context, string) (values []string)   { return }
@@ -214,3 +359,14 @@ func (UnimplementedHost) GetResponseTrailerValues(context.Context, string) (valu
 func (UnimplementedHost) SetResponseTrailerValue(context.Context, string, string)            {}
 func (UnimplementedHost) AddResponseTrailerValue(context.Context, string, string)            {}
 func (UnimplementedHost) RemoveResponseTrailer(context.Context, string)                      {}
+func (UnimplementedHost) GetRequestCookieNames(context.Context) (names []string)             { return }
+func (UnimplementedHost) GetRequestCookieValues(context.Context, string) (values []string)   { return }
+func (UnimplementedHost) SetResponseCookie(context.Context, Cookie)                          {}
+func (UnimplementedHost) DeleteResponseCookie(context.Context, string, string, string)       {}
+func (UnimplementedHost) GetRemoteAddr(context.Context) string                               { return "" }
+func (UnimplementedHost) GetLocalAddr(context.Context) string                                { return "" }
+func (UnimplementedHost) GetTLSVersion(context.Context) string                               { return "" }
+func (UnimplementedHost) GetTLSCipherSuite(context.Context) string                           { return "" }
+func (UnimplementedHost) GetTLSServerName(context.Context) string                            { return "" }
+func (UnimplementedHost) GetTLSPeerSubject(context.Context) string                           { return "" }
+func (UnimplementedHost) GetTLSPeerSANs(context.Context) (sans []string)                     { return }
@@ -75,6 +75,24 @@ type CountLen = uint64
 // Note: `EOF` is not an error, so process `len` bytes returned regardless.
 type EOFLen = uint64
 
+// CompressedLen is the result of FuncReadGRPCMessage which describes a gRPC
+// message. For compatability with WebAssembly Core Specification 1.0, two
+// uint32 values are combined into a single uint64 in the following order:
+//
+//   - compressed: one if the message is compressed, or zero.
+//   - len: possibly zero length of the message in bytes.
+//
+// Here's how to split the results:
+//
+//   - compressed: `uint32(compressedLen >> 32)`
+//   - len: `uint32(compressedLen)`
+//
+// # Examples
+//
+//   - 0<<32|0 (0): an empty, uncompressed message
+//   - 1<<32|16 (4294967312): a compressed message of 16 bytes
+type CompressedLen = uint64
+
 type BodyKind uint32
 
 const (
@@ -87,10 +105,16 @@ const (
 	// Otherwise, a downstream handler may panic attempting to read a request
 	// body already read upstream.
 	//
+	// When FeatureStreamRequest is enabled, FuncReadBody reads the current
+	// chunk inside FuncHandleRequestBody.
+	//
+	// When FeatureDecodeContent is enabled, FuncReadBody reads the decoded
+	// request body.
+	//
 	// # Notes on FuncWriteBody
 	//
 	// The first call to FuncWriteBody in FuncHandleRequest overwrites any request
-	// body.
+	// body. Inside FuncHandleRequestBody, it overwrites the current chunk.
 	BodyKindRequest BodyKind = 0
 
 	// BodyKindResponse represents an operation on an HTTP request body.
@@ -101,10 +125,17 @@ const (
 	// FuncNext. To enable it, call FuncEnableFeatures beforehand. Otherwise,
 	// a handler may panic calling FuncReadBody with BodyKindResponse.
 	//
+	// When FeatureStreamResponse is enabled instead, FuncReadBody reads the
+	// current chunk inside FuncHandleResponseBody.
+	//
+	// When FeatureDecodeContent is enabled, FuncReadBody reads the decoded
+	// response body.
+	//
 	// # Notes on FuncWriteBody
 	//
 	// The first call to FuncWriteBody in FuncHandleRequest or after FuncNext
-	// overwrites any response body.
+	// overwrites any response body. Inside FuncHandleResponseBody, it
+	// overwrites the current chunk.
 	BodyKindResponse BodyKind = 1
 )
 
@@ -122,6 +153,9 @@ const (
 	//
 	// To enable FeatureTrailers, call FuncEnableFeatures prior to FuncNext.
 	// Doing otherwise, may result in a panic.
+	//
+	// Note: Request trailers are only readable once the request body was read
+	// to EOF, for example with FuncReadBody and FeatureBufferRequest.
 	HeaderKindRequestTrailers HeaderKind = 2
 
 	// HeaderKindResponseTrailers represents an operation on HTTP response
@@ -129,9 +163,77 @@ const (
 	//
 	// To enable FeatureTrailers, call FuncEnableFeatures prior to FuncNext.
 	// Doing otherwise, may result in a panic.
+	//
+	// After FuncNext, changing response trailers requires
+	// FeatureBufferResponse or FeatureStreamResponse. As trailers are sent
+	// after the body, they can change while streaming even after the response
+	// headers were sent. The host declares trailers in the "Trailer" response
+	// header when sending it, and panics on changes once trailers can no
+	// longer be sent, such as a HTTP/1.1 response sent with a
+	// "Content-Length".
 	HeaderKindResponseTrailers HeaderKind = 3
 )
 
+// CookieFlags is a bit flag of attributes of a cookie set by FuncSetCookie.
+//
+// Note: At most one of the CookieFlagSameSite flags may be set.
+type CookieFlags uint32
+
+const (
+	// CookieFlagSecure adds the "Secure" attribute, so that the client only
+	// sends the cookie over HTTPS.
+	CookieFlagSecure CookieFlags = 1 << iota
+
+	// CookieFlagHttpOnly adds the "HttpOnly" attribute, so that scripts can't
+	// read the cookie.
+	CookieFlagHttpOnly
+
+	// CookieFlagSameSiteLax adds the attribute "SameSite=Lax".
+	CookieFlagSameSiteLax
+
+	// CookieFlagSameSiteStrict adds the attribute "SameSite=Strict".
+	CookieFlagSameSiteStrict
+
+	// CookieFlagSameSiteNone adds the attribute "SameSite=None".
+	CookieFlagSameSiteNone
+)
+
+// ReplaceFlags is a bit flag of options of FuncReplaceBody.
+type ReplaceFlags uint32
+
+const (
+	// ReplaceFlagRegexp interprets the pattern as a regular expression in
+	// RE2 syntax, instead of literal bytes. The replacement can then refer
+	// to submatches, such as "$1" or "${name}".
+	//
+	// See https://pkg.go.dev/regexp#Regexp.Expand
+	ReplaceFlagRegexp ReplaceFlags = 1 << iota
+)
+
+// Cookie is a response cookie set by FuncSetCookie.
+//
+// See https://www.rfc-editor.org/rfc/rfc6265#section-4.1
+type Cookie struct {
+	// Name is the non-empty name of the cookie.
+	Name string
+
+	// Value is the possibly empty value of the cookie.
+	Value string
+
+	// Path is the "Path" attribute or empty to not send one.
+	Path string
+
+	// Domain is the "Domain" attribute or empty to not send one.
+	Domain string
+
+	// MaxAge is the "Max-Age" attribute in seconds. Zero means to not send
+	// one, and negative means the client should delete the cookie now.
+	MaxAge int32
+
+	// Flags are the remaining attributes, such as "Secure".
+	Flags CookieFlags
+}
+
 const (
 	// HostModule is the WebAssembly module name of the ABI this middleware
 	// implements.
@@ -192,6 +294,20 @@ const (
 	//
 	// To skip any next handler, the guest returns CtxNext `next=0`, or simply
 	// uint64(0). In this case, FuncHandleResponse will not be called.
+	//
+	// # Protocol upgrades
+	//
+	// A request to upgrade the connection, such as a WebSocket handshake, has
+	// a "Connection" header including "upgrade" and an "Upgrade" header. The
+	// guest approves it by proceeding to the next handler, or rejects it by
+	// responding itself, for example with status 403.
+	//
+	// As the next handler takes over the connection, the host doesn't buffer
+	// or stream bodies of upgrade requests: FuncEnableFeatures doesn't enable
+	// FeatureBufferRequest, FeatureBufferResponse, FeatureStreamRequest,
+	// FeatureStreamResponse or FeatureDecodeContent for them. In
+	// FuncHandleResponse, FuncGetStatusCode returns 101 if the connection was
+	// upgraded.
 	FuncHandleRequest = "handle_request"
 
 	// FuncHandleResponse is called by the host after processing the next
@@ -211,6 +327,50 @@ const (
 	// TODO: update
 	FuncHandleResponse = "handle_response"
 
+	// FuncHandleResponseBody is an optional guest export called by the host
+	// for each chunk of the response body when FeatureStreamResponse is
+	// enabled. Its signature is (reqCtx i32, endOfStream i32) -> ().
+	//
+	// The `reqCtx` parameter is the same as FuncHandleResponse.
+	//
+	// The `endOfStream` parameter is zero while the next handler writes the
+	// body. In this case, FuncReadBody with BodyKindResponse reads the current
+	// chunk. If the guest calls FuncWriteBody with BodyKindResponse, what it
+	// writes is sent instead of the chunk. Otherwise, the chunk is sent
+	// unchanged.
+	//
+	// After the next handler returns, the host calls this once more with
+	// `endOfStream` one and no chunk to read. This allows the guest to write
+	// any remaining data. FuncHandleResponse is called afterwards.
+	//
+	// Note: The response status code and headers are sent after the first
+	// call returns, or as soon as the guest writes the body.
+	//
+	// TODO: document on http-wasm-abi
+	FuncHandleResponseBody = "handle_response_body"
+
+	// FuncHandleRequestBody is an optional guest export called by the host
+	// for each chunk of the request body when FeatureStreamRequest is
+	// enabled. Its signature is (reqCtx i32, endOfStream i32) -> ().
+	//
+	// The `reqCtx` parameter is the same as FuncHandleResponse.
+	//
+	// The `endOfStream` parameter is zero while the next handler reads the
+	// body. In this case, FuncReadBody with BodyKindRequest reads the current
+	// chunk. If the guest calls FuncWriteBody with BodyKindRequest, what it
+	// writes is read by the next handler instead of the chunk. Otherwise, the
+	// chunk is read unchanged.
+	//
+	// After the host reads the end of the request body, it calls this once
+	// more with `endOfStream` one and no chunk to read. This allows the guest
+	// to write any remaining data.
+	//
+	// Note: This is called while the next handler reads the body, so it is
+	// not called at all if the next handler doesn't read it.
+	//
+	// TODO: document on http-wasm-abi
+	FuncHandleRequestBody = "handle_request_body"
+
 	// FuncGetMethod writes the method to memory if it isn't larger than
 	// BufLimit. The result is its length in bytes. Ex. "GET"
 	//
@@ -250,6 +410,81 @@ const (
 	// See https://github.com/httpwasm/http-wasm-abi/blob/main/http_handler/http_handler.wit.md#set_uri
 	FuncSetURI = "set_uri"
 
+	// FuncGetQueryNames writes the names of all query parameters of the
+	// request URI, NUL-terminated, to memory if the encoded length isn't
+	// larger than BufLimit. CountLen is returned regardless of whether memory
+	// was written.
+	//
+	// Note: Names are decoded, so "?a%26b=c" results in the name "a&b".
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetQueryNames = "get_query_names"
+
+	// FuncGetQueryValues writes all values of the given query parameter,
+	// NUL-terminated, to memory if the encoded length isn't larger than
+	// BufLimit. CountLen is returned regardless of whether memory was written.
+	//
+	// Note: Values are decoded, so "?a=b%26c" results in the value "b&c".
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetQueryValues = "get_query_values"
+
+	// FuncSetQueryValue overwrites all values of the given query parameter
+	// with the input. The host re-encodes the query of the request URI.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetQueryValue = "set_query_value"
+
+	// FuncAddQueryValue adds a single value for the given query parameter.
+	// The host re-encodes the query of the request URI.
+	//
+	// TODO: document on http-wasm-abi
+	FuncAddQueryValue = "add_query_value"
+
+	// FuncRemoveQuery removes any values for the given query parameter. The
+	// host re-encodes the query of the request URI.
+	//
+	// TODO: document on http-wasm-abi
+	FuncRemoveQuery = "remove_query"
+
+	// FuncGetScheme writes the scheme of the request URL to memory if it
+	// isn't larger than BufLimit. The result is its length in bytes.
+	// Ex. "https"
+	//
+	// Note: Servers usually receive requests in origin-form, which have no
+	// scheme. In this case, the host returns the scheme implied by the
+	// connection, such as "https" when it uses TLS.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetScheme = "get_scheme"
+
+	// FuncSetScheme overwrites the scheme of the request URL with one read
+	// from memory. Ex. "https"
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetScheme = "set_scheme"
+
+	// FuncGetAuthority writes the authority of the request to memory if it
+	// isn't larger than BufLimit. The result is its length in bytes.
+	// Ex. "example.com:8080"
+	//
+	// In HTTP/1.1, this is the "Host" header. In HTTP/2 and HTTP/3, this is
+	// the ":authority" pseudo-header, which intermediaries translate to and
+	// from the "Host" header. Either way, the authority is also visible as
+	// the "Host" header via FuncGetHeaderValues with HeaderKindRequest, and
+	// changing that header changes the authority.
+	//
+	// See https://www.rfc-editor.org/rfc/rfc9113#section-8.3.1
+	// TODO: document on http-wasm-abi
+	FuncGetAuthority = "get_authority"
+
+	// FuncSetAuthority overwrites the authority of the request with one read
+	// from memory. This is the same as calling FuncSetHeaderValue with
+	// HeaderKindRequest and the name "Host".
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetAuthority = "set_authority"
+
 	// FuncGetProtocolVersion writes the HTTP protocol version to memory if it
 	// isn't larger than BufLimit. The result is its length in bytes.
 	// Ex. "HTTP/1.1"
@@ -289,6 +524,32 @@ const (
 	// TODO: document on http-wasm-abi
 	FuncRemoveHeader = "remove_header"
 
+	// FuncGetHeaders writes all headers of the given HeaderKind to memory as
+	// alternating NUL-terminated names and values, if the encoded length
+	// isn't larger than BufLimit. Names are lowercase, as with
+	// FuncGetHeaderNames, and repeat for each of their values. For example,
+	// "accept\x00text/html\x00accept\x00*/*\x00".
+	//
+	// CountLen is returned regardless of whether memory was written. Its
+	// count is that of names and values, so twice the count of values.
+	//
+	// This replaces calling FuncGetHeaderNames, then FuncGetHeaderValues for
+	// each name.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetHeaders = "get_headers"
+
+	// FuncSetHeaders sets headers of the given HeaderKind read from memory as
+	// alternating NUL-terminated names and values, in the same format as
+	// FuncGetHeaders. The first value of a header replaces any existing, and
+	// later ones are added. Headers not in memory are left as-is.
+	//
+	// This has the same requirements as FuncSetHeaderValue, and replaces
+	// calling it, then FuncAddHeaderValue for any more values.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetHeaders = "set_headers"
+
 	// FuncReadBody reads up to BufLimit bytes remaining in the BodyKind body
 	// into memory at offset `buf`. A zero BufLimit will panic.
 	//
@@ -302,6 +563,17 @@ const (
 	// TODO: document on http-wasm-abi
 	FuncReadBody = "read_body"
 
+	// FuncBodyLen returns the count of bytes remaining in the BodyKind body,
+	// which FuncReadBody would read until EOF, so that the caller can size a
+	// buffer exactly. This has the same requirements as FuncReadBody.
+	//
+	// The result is -1 when the length isn't known, for example when the
+	// host streams the body or spilled it to disk. Callers then read until
+	// EOF as usual.
+	//
+	// TODO: document on http-wasm-abi
+	FuncBodyLen = "body_len"
+
 	// FuncWriteBody reads `buf_len` bytes at memory offset `buf` and writes
 	// them to the pending BodyKind body.
 	//
@@ -311,11 +583,33 @@ const (
 	// TODO: document on http-wasm-abi
 	FuncWriteBody = "write_body"
 
-	// FuncGetStatusCode returns the status code produced by FuncNext. This
-	// requires FeatureBufferResponse.
+	// FuncReplaceBody replaces every match of a pattern in the BodyKind body
+	// with a replacement, on the host, and returns the count of replacements.
+	// This avoids copying a body through memory to redact or rewrite parts
+	// of it.
 	//
-	// To enable FeatureBufferResponse, FuncEnableFeatures prior to FuncNext.
-	// Doing otherwise, or calling before FuncNext will panic.
+	// The pattern and replacement are read from memory at offsets `pattern`
+	// and `replacement`. The pattern is literal bytes, unless flags include
+	// ReplaceFlagRegexp. An empty pattern or unsupported flags will panic.
+	//
+	// Like FuncReadBody, this replaces in what remains of the body, so call
+	// it before reading. Afterwards, FuncReadBody reads the result, and if
+	// anything was replaced, FuncWriteBody appends to it. Requirements of
+	// both FuncReadBody and FuncWriteBody apply, so for example, replacing in
+	// a response body requires FeatureBufferResponse.
+	//
+	// TODO: document on http-wasm-abi
+	FuncReplaceBody = "replace_body"
+
+	// FuncGetStatusCode returns the status code of the response, which
+	// defaults to 200. This can be called in any phase:
+	//
+	//   - Before FuncNext, this is the status code set by FuncSetStatusCode.
+	//   - After FuncNext, this is the status code written by the next
+	//     handler, unless overridden by FuncSetStatusCode.
+	//
+	// Informational (1xx) responses other than 101 aren't final, so don't
+	// change the status code.
 	//
 	// TODO: document on http-wasm-abi
 	FuncGetStatusCode = "get_status_code"
@@ -325,6 +619,273 @@ const (
 	// To use this function after FuncNext, set FeatureBufferResponse via
 	// FuncEnableFeatures. Otherwise, this can be called when FuncNext wasn't.
 	//
+	// The status code must be between 100 and 999, or the host panics with
+	// StatusCodeError.
+	//
 	// TODO: document on http-wasm-abi
 	FuncSetStatusCode = "set_status_code"
+
+	// FuncSetReasonPhrase overrides the reason phrase of the HTTP/1.1 status
+	// line, such as "OK" in "HTTP/1.1 200 OK". An empty reason phrase means
+	// the default for the status code. This has the same requirements as
+	// FuncSetStatusCode.
+	//
+	// The reason phrase can't contain control characters other than
+	// horizontal tab, per RFC 9112.
+	//
+	// Note: The host panics if it doesn't implement ReasonPhraseHost, which
+	// is never the case for HTTP/2 or later.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetReasonPhrase = "set_reason_phrase"
+
+	// FuncSendInformational sends an informational (1xx) response with the
+	// current response headers, before the final response. For example, the
+	// guest can add "Link" headers and send 103 Early Hints, so that the
+	// client preloads resources while the next handler is working.
+	//
+	// The status code must be between 100 and 199, except 101 which is only
+	// sent by the next handler when upgrading the connection, or the host
+	// panics with StatusCodeError. This can be
+	// called any number of times, but only before FuncNext. Headers sent
+	// remain in the final response.
+	//
+	// Note: The host panics if it doesn't implement InformationalHost.
+	//
+	// See https://www.rfc-editor.org/rfc/rfc8297
+	// TODO: document on http-wasm-abi
+	FuncSendInformational = "send_informational"
+
+	// FuncSendResponse sends a complete response at once, so that the guest
+	// can reply locally, such as rejecting an unauthorized request, without
+	// calling FuncSetStatusCode, FuncSetHeaderValue and FuncWriteBody.
+	//
+	// The parameters are the status code, the response headers and the
+	// response body. Headers are alternating NUL-terminated names and values.
+	// For example, "Content-Type\x00text/plain\x00". The first value of a
+	// header replaces any set before, and later ones are added. The status
+	// code must be between 100 and 999, or the host panics with
+	// StatusCodeError.
+	//
+	// The host validates all parameters before changing the response, so it
+	// is never partially written. If the host implements ResponseSentHost,
+	// it panics when the response headers were already sent, for example by
+	// FuncWriteBody without buffering. Afterwards, the response status code,
+	// headers and body can't change, and FuncHandleRequest must return
+	// next=0.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSendResponse = "send_response"
+
+	// FuncGetCookieNames writes the names of all cookies in the "Cookie"
+	// request header, NUL-terminated, to memory if the encoded length isn't
+	// larger than BufLimit. CountLen is returned regardless of whether memory
+	// was written.
+	//
+	// Note: Each name is only written once, even if there are multiple
+	// cookies with that name.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetCookieNames = "get_cookie_names"
+
+	// FuncGetCookieValues writes the values of all cookies in the "Cookie"
+	// request header with the given name, NUL-terminated, to memory if the
+	// encoded length isn't larger than BufLimit. CountLen is returned
+	// regardless of whether memory was written.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetCookieValues = "get_cookie_values"
+
+	// FuncSetCookie adds a "Set-Cookie" response header serialized by the
+	// host from the given name, value, path, domain, max_age and CookieFlags.
+	// Any pending response cookie with the same name, path and domain is
+	// replaced.
+	//
+	// See Cookie for the meaning of each parameter. Like FuncSetHeaderValue
+	// with HeaderKindResponse, calling this after FuncNext requires
+	// FeatureBufferResponse.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetCookie = "set_cookie"
+
+	// FuncDeleteCookie removes any pending response cookie with the given
+	// name, path and domain, then adds a "Set-Cookie" response header which
+	// instructs the client to delete its copy.
+	//
+	// Like FuncSetHeaderValue with HeaderKindResponse, calling this after
+	// FuncNext requires FeatureBufferResponse.
+	//
+	// TODO: document on http-wasm-abi
+	FuncDeleteCookie = "delete_cookie"
+
+	// FuncGetFormNames writes the names of all non-file fields in the request
+	// form, NUL-terminated, to memory if the encoded length isn't larger than
+	// BufLimit. CountLen is returned regardless of whether memory was
+	// written.
+	//
+	// The form is parsed by the host from the request body when its
+	// "Content-Type" is "application/x-www-form-urlencoded" or
+	// "multipart/form-data". Any other body has no form fields. Query
+	// parameters are not included: use FuncGetQueryNames for those.
+	//
+	// The body is parsed once per request, on the first call to any form
+	// function, and consumes what the guest hasn't read via FuncReadBody.
+	// Before FuncNext, the host writes the parsed bytes back to the request
+	// body, so they remain available to FuncReadBody and the next handler.
+	// After FuncNext, this requires FeatureBufferRequest.
+	//
+	// Note: The host fails the request if the body is larger than the
+	// configured maximum form size.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetFormNames = "get_form_names"
+
+	// FuncGetFormValues writes the values of the non-file request form field
+	// with the given name, NUL-terminated, to memory if the encoded length
+	// isn't larger than BufLimit. CountLen is returned regardless of whether
+	// memory was written.
+	//
+	// See FuncGetFormNames for how the form is parsed.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetFormValues = "get_form_values"
+
+	// FuncGetFormFileNames writes the names of all "multipart/form-data"
+	// request form fields which contain at least one file, NUL-terminated, to
+	// memory if the encoded length isn't larger than BufLimit. CountLen is
+	// returned regardless of whether memory was written.
+	//
+	// See FuncGetFormNames for how the form is parsed.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetFormFileNames = "get_form_file_names"
+
+	// FuncGetFormFileHeaders writes the MIME headers of a file in the request
+	// form field with the given name, NUL-terminated, to memory if the
+	// encoded length isn't larger than BufLimit. CountLen is returned
+	// regardless of whether memory was written.
+	//
+	// The i32 index parameter selects the file, as a field may contain more
+	// than one. Each header is encoded as "Name: value", with one entry per
+	// value. Ex. "Content-Disposition: form-data; name=\"f\"; filename=\"a.txt\""
+	//
+	// Note: The count is zero if the field has no file at that index.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetFormFileHeaders = "get_form_file_headers"
+
+	// FuncGetGRPCMessageCount returns the count of gRPC messages in the body
+	// of the given BodyKind, as a uint32.
+	//
+	// gRPC frames each message with a 5-byte prefix: a compressed flag and
+	// the big-endian uint32 length of the message. The host parses the body
+	// on the first call to any gRPC message function for the BodyKind, and
+	// again after FuncWriteBody overwrites it.
+	//
+	// For BodyKindRequest, this consumes what the guest hasn't read via
+	// FuncReadBody. Before FuncNext, the host writes the parsed bytes back to
+	// the request body, like FuncGetFormNames. After FuncNext, this requires
+	// FeatureBufferRequest. For BodyKindResponse after FuncNext, this
+	// requires FeatureBufferResponse.
+	//
+	// Note: The host fails the request if the body ends in the middle of a
+	// message. It also fails with BufferLimitError if the request body
+	// exceeds the host's limit, which a host may send as the gRPC status
+	// RESOURCE_EXHAUSTED.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetGRPCMessageCount = "get_grpc_message_count"
+
+	// FuncReadGRPCMessage writes the gRPC message at the given index in the
+	// body of the given BodyKind to memory if it isn't larger than BufLimit.
+	// CompressedLen is returned regardless of whether memory was written.
+	//
+	// The message excludes its 5-byte prefix. The i32 index must be less than
+	// the result of FuncGetGRPCMessageCount, or the host panics.
+	//
+	// TODO: document on http-wasm-abi
+	FuncReadGRPCMessage = "read_grpc_message"
+
+	// FuncSendGRPCStatus responds with a gRPC status read from memory, for
+	// example to deny a request without calling FuncNext. The i32 code is the
+	// gRPC status code, such as 7 for PERMISSION_DENIED. The host panics if
+	// it isn't between 0 and 16.
+	//
+	// The host sends a "Trailers-Only" response: status code 200 with the
+	// "Content-Type", "Grpc-Status" and "Grpc-Message" headers, and no body.
+	// The message is percent-encoded as gRPC requires. After FuncNext, this
+	// requires FeatureBufferResponse, and also removes any "Grpc-Status" and
+	// "Grpc-Message" trailers set by the next handler.
+	//
+	// See https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+	// TODO: document on http-wasm-abi
+	FuncSendGRPCStatus = "send_grpc_status"
+
+	// FuncGetRemoteAddr writes the network address of the client that sent
+	// the request to memory if it isn't larger than BufLimit. The result is
+	// its length in bytes. Ex. "192.0.2.1:51234"
+	//
+	// Note: This is the address of the immediate peer, which may be a proxy.
+	// The result is empty if the host cannot determine it.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetRemoteAddr = "get_remote_addr"
+
+	// FuncGetLocalAddr writes the network address the request was received
+	// on to memory if it isn't larger than BufLimit. The result is its length
+	// in bytes. Ex. "192.0.2.2:443"
+	//
+	// Note: The result is empty if the host cannot determine it.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetLocalAddr = "get_local_addr"
+
+	// FuncGetTLSVersion writes the TLS version negotiated for the connection
+	// to memory if it isn't larger than BufLimit. The result is its length in
+	// bytes. Ex. "TLS 1.3"
+	//
+	// Note: The result is empty when the request was not received over TLS.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetTLSVersion = "get_tls_version"
+
+	// FuncGetTLSCipherSuite writes the name of the TLS cipher suite negotiated
+	// for the connection to memory if it isn't larger than BufLimit. The
+	// result is its length in bytes. Ex. "TLS_AES_128_GCM_SHA256"
+	//
+	// Note: The result is empty when the request was not received over TLS.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetTLSCipherSuite = "get_tls_cipher_suite"
+
+	// FuncGetTLSServerName writes the server name (SNI) requested by the
+	// client to memory if it isn't larger than BufLimit. The result is its
+	// length in bytes. Ex. "example.com"
+	//
+	// Note: The result is empty when the request was not received over TLS
+	// or the client didn't send a server name.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetTLSServerName = "get_tls_server_name"
+
+	// FuncGetTLSPeerSubject writes the distinguished name of the subject of
+	// the client certificate to memory if it isn't larger than BufLimit. The
+	// result is its length in bytes. Ex. "CN=client,O=Example"
+	//
+	// Note: The result is empty when the client didn't present a certificate.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetTLSPeerSubject = "get_tls_peer_subject"
+
+	// FuncGetTLSPeerSANs writes all subject alternative names of the client
+	// certificate, NUL-terminated, to memory if the encoded length isn't
+	// larger than BufLimit. CountLen is returned regardless of whether memory
+	// was written.
+	//
+	// Each name is prefixed with its type, like openssl does. For example,
+	// "DNS:example.com", "IP:192.0.2.1", "email:a@example.com" or
+	// "URI:spiffe://example.com/client".
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetTLSPeerSANs = "get_tls_peer_sans"
 )
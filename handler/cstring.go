@@ -1,8 +1,8 @@
 package handler
 
 import (
-	"bytes"
 	"context"
+	"strings"
 
 	wazeroapi "github.com/tetratelabs/wazero/api"
 
@@ -14,6 +14,21 @@ func writeNULTerminated(
 	mem wazeroapi.Memory,
 	buf uint32, bufLimit handler.BufLimit,
 	input []string,
+) (countLen handler.CountLen) {
+	return writeNULTerminatedLower(ctx, mem, buf, bufLimit, input, 0)
+}
+
+// writeNULTerminatedLower is like writeNULTerminated, except it lowercases
+// every lowerEvery-th string while writing, starting with the first, so that
+// header names are lowercase without allocating. For example, one lowercases
+// all names, and two lowercases alternating names and values. Zero
+// lowercases nothing.
+func writeNULTerminatedLower(
+	_ context.Context,
+	mem wazeroapi.Memory,
+	buf uint32, bufLimit handler.BufLimit,
+	input []string,
+	lowerEvery int,
 ) (countLen handler.CountLen) {
 	count := uint32(len(input))
 	if count == 0 {
@@ -32,16 +47,50 @@ func writeNULTerminated(
 	}
 
 	// Write the NUL-terminated string to memory directly.
-	s, ok := mem.Read(buf, byteCount)
+	b, ok := mem.Read(buf, byteCount)
 	if !ok {
 		panic("out of memory") // the guest passed a region outside memory.
 	}
 
-	b := bytes.NewBuffer(s)
-	b.Reset()
-	for _, h := range input {
-		b.WriteString(h)
-		b.WriteByte(0)
+	pos := 0
+	for i, s := range input {
+		n := copy(b[pos:], s)
+		if lowerEvery > 0 && i%lowerEvery == 0 {
+			asciiLower(b[pos : pos+n])
+		}
+		pos += n
+		b[pos] = 0
+		pos++
 	}
 	return
 }
+
+// asciiLower lowercases ASCII letters in place, which is enough for header
+// names as they are tokens.
+func asciiLower(b []byte) {
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+}
+
+// mustParseHeaderBlock parses alternating NUL-terminated header names and
+// values, such as "Content-Type\x00text/plain\x00".
+func mustParseHeaderBlock(block string) []string {
+	if block == "" {
+		return nil
+	} else if block[len(block)-1] != 0 {
+		panic("header block must be NUL-terminated")
+	}
+	fields := strings.Split(block[:len(block)-1], "\x00")
+	if len(fields)%2 != 0 {
+		panic("header block must have a value for each name")
+	}
+	for i := 0; i < len(fields); i += 2 {
+		if fields[i] == "" {
+			panic("HTTP header name cannot be empty")
+		}
+	}
+	return fields
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// memoryWasm is a module which only exports one page of memory.
+var memoryWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	0x05, 0x03, 0x01, 0x00, 0x01, // memory section: one page
+	0x07, 0x0a, 0x01, 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00, // export "memory"
+}
+
+func Test_writeNULTerminatedLower(t *testing.T) {
+	r := wazero.NewRuntime(testCtx)
+	defer r.Close(testCtx)
+	mod, err := r.Instantiate(testCtx, memoryWasm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := mod.Memory()
+
+	tests := []struct {
+		name       string
+		input      []string
+		lowerEvery int
+		want       string
+	}{
+		{
+			name:  "none",
+			input: []string{"Content-Type", "Text/Plain"},
+			want:  "Content-Type\x00Text/Plain\x00",
+		},
+		{
+			name:       "names",
+			input:      []string{"Content-Type", "X-ABC"},
+			lowerEvery: 1,
+			want:       "content-type\x00x-abc\x00",
+		},
+		{
+			name:       "names and values",
+			input:      []string{"Content-Type", "Text/Plain", "Accept", "*/*"},
+			lowerEvery: 2,
+			want:       "content-type\x00Text/Plain\x00accept\x00*/*\x00",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			countLen := writeNULTerminatedLower(testCtx, mem, 0, 1024, tc.input, tc.lowerEvery)
+			if want, have := uint32(len(tc.input)), uint32(countLen>>32); want != have {
+				t.Errorf("unexpected count, want: %d, have: %d", want, have)
+			}
+			have, _ := mem.Read(0, uint32(countLen))
+			if want := tc.want; want != string(have) {
+				t.Errorf("unexpected memory, want: %q, have: %q", want, have)
+			}
+
+			allocs := testing.AllocsPerRun(10, func() {
+				writeNULTerminatedLower(testCtx, mem, 0, 1024, tc.input, tc.lowerEvery)
+			})
+			if allocs != 0 {
+				t.Errorf("expected no allocations, have %v", allocs)
+			}
+		})
+	}
+}
+
+func Benchmark_writeNULTerminatedLower(b *testing.B) {
+	r := wazero.NewRuntime(testCtx)
+	defer r.Close(testCtx)
+	mod, err := r.Instantiate(testCtx, memoryWasm)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mem := mod.Memory()
+	names := []string{"Accept", "Accept-Encoding", "Content-Type", "Host", "User-Agent"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writeNULTerminatedLower(testCtx, mem, 0, 1024, names, 1)
+	}
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"sort"
+
+	"github.com/httpwasm/http-wasm-host-go/api/handler"
+)
+
+// mustForm returns the request form, parsing it from the request body on
+// first use. See handler.FuncGetFormNames for details.
+func (m *middleware) mustForm(ctx context.Context) *multipart.Form {
+	s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferRequest, "read", "request form")
+	if s.form != nil {
+		return s.form
+	}
+
+	var contentType string
+	if values := m.host.GetRequestHeaderValues(ctx, "Content-Type"); len(values) > 0 {
+		contentType = values[0]
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(m.mustReadRequestBody(ctx, s, "request form", m.limits.MaxFormSize, nil)))
+		if err != nil {
+			panic(fmt.Errorf("error parsing request form: %w", err))
+		}
+		s.form = &multipart.Form{Value: values}
+	case "multipart/form-data":
+		boundary := params["boundary"]
+		if boundary == "" {
+			panic("multipart request form has no boundary")
+		}
+		body := m.mustReadRequestBody(ctx, s, "request form", m.limits.MaxFormSize, nil)
+		r := multipart.NewReader(bytes.NewReader(body), boundary)
+		f, err := r.ReadForm(m.limits.MaxFormSize)
+		if err != nil {
+			panic(fmt.Errorf("error parsing request form: %w", err))
+		}
+		s.form = f
+	default: // not a form, so don't consume the body.
+		s.form = &multipart.Form{}
+	}
+	return s.form
+}
+
+// mustReadRequestBody reads the rest of the request body, up to limit bytes
+// unless zero. Before the next handler, this enables
+// handler.FeatureBufferRequest first, so that the host replays the original
+// body to it. Either way, the guest can read the bytes again via
+// handler.FuncReadBody. The kind describes the body in errors, and limitErr,
+// if not nil, is raised when it exceeds the limit.
+func (m *middleware) mustReadRequestBody(ctx context.Context, s *requestState, kind string, limit int64, limitErr error) []byte {
+	r := s.requestBodyReader
+	if r == nil && !s.afterNext && !s.features.IsEnabled(handler.FeatureBufferRequest) {
+		s.features = m.host.EnableFeatures(ctx, s.features.WithEnabled(handler.FeatureBufferRequest))
+	}
+	// Replay from the buffer, unless the host couldn't buffer or the guest
+	// already read part of the body without buffering.
+	replay := s.afterNext || (r == nil && s.features.IsEnabled(handler.FeatureBufferRequest))
+	if r == nil {
+		r = m.host.RequestBodyReader(ctx)
+	}
+
+	var body []byte
+	var err error
+	if limit > 0 {
+		body, err = io.ReadAll(io.LimitReader(r, limit+1))
+	} else {
+		body, err = io.ReadAll(r)
+	}
+	if err != nil {
+		panic(fmt.Errorf("error reading %s: %w", kind, err))
+	} else if limit > 0 && int64(len(body)) > limit {
+		if limitErr != nil {
+			panic(limitErr)
+		}
+		panic(fmt.Errorf("%s exceeds %d bytes", kind, limit))
+	}
+
+	if !replay {
+		if _, err = m.host.RequestBodyWriter(ctx).Write(body); err != nil {
+			panic(fmt.Errorf("error writing %s: %w", kind, err))
+		}
+	}
+
+	// The guest reads what was parsed next.
+	_ = r.Close()
+	s.requestBodyBytes.b = body
+	s.requestBodyReader = &s.requestBodyBytes
+	return body
+}
+
+// formFileHeaders returns the MIME headers of a form file as "Name: value"
+// entries, or nil if there is no file at the index.
+func formFileHeaders(f *multipart.Form, name string, index uint32) []string {
+	files := f.File[name]
+	if index >= uint32(len(files)) {
+		return nil
+	}
+	header := files[index].Header
+	names := sortedKeys(header)
+	headers := make([]string, 0, len(names))
+	for _, n := range names {
+		for _, v := range header[n] {
+			headers = append(headers, n+": "+v)
+		}
+	}
+	return headers
+}
+
+// sortedKeys returns the keys of the map in lexicographic order, for
+// deterministic results.
+func sortedKeys[V any](m map[string]V) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
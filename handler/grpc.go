@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/httpwasm/http-wasm-host-go/api/handler"
+)
+
+// grpcPrefixLen is the length of the prefix of each gRPC message: a
+// compressed flag and the big-endian uint32 length of the message.
+const grpcPrefixLen = 5
+
+// grpcMessage is a gRPC message parsed from a body, without its prefix.
+type grpcMessage struct {
+	compressed bool
+	data       []byte
+}
+
+// mustGRPCMessages returns the gRPC messages in the body of the given kind,
+// parsing it on first use. See handler.FuncGetGRPCMessageCount for details.
+func (m *middleware) mustGRPCMessages(ctx context.Context, kind handler.BodyKind) []grpcMessage {
+	switch kind {
+	case handler.BodyKindRequest:
+		s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferRequest, "read", "gRPC request messages")
+		if s.grpcRequest == nil {
+			// Parsing holds the body in memory, so it is never unlimited.
+			limit := m.limits.MaxRequestBuffer
+			if limit <= 0 {
+				limit = m.limits.MaxFormSize
+			}
+			limitErr := &handler.BufferLimitError{Kind: handler.BodyKindRequest, Limit: limit}
+			s.grpcRequest = mustParseGRPCMessages(m.mustReadRequestBody(ctx, s, "gRPC request", limit, limitErr))
+		}
+		return s.grpcRequest
+	case handler.BodyKindResponse:
+		s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "read", "gRPC response messages")
+		if s.grpcResponse == nil {
+			r := m.host.ResponseBodyReader(ctx)
+			body, err := io.ReadAll(r)
+			_ = r.Close()
+			if err != nil {
+				panic(fmt.Errorf("error reading gRPC response: %w", err))
+			}
+			s.grpcResponse = mustParseGRPCMessages(body)
+		}
+		return s.grpcResponse
+	default:
+		panic("unsupported body kind: " + strconv.Itoa(int(kind)))
+	}
+}
+
+// mustParseGRPCMessages parses a body of length-prefixed gRPC messages. The
+// result is never nil, so that it can be distinguished from an unparsed body.
+func mustParseGRPCMessages(body []byte) []grpcMessage {
+	messages := []grpcMessage{}
+	for len(body) > 0 {
+		if len(body) < grpcPrefixLen {
+			panic(fmt.Errorf("gRPC message prefix is truncated to %d bytes", len(body)))
+		}
+		flag, length := body[0], binary.BigEndian.Uint32(body[1:grpcPrefixLen])
+		if flag > 1 {
+			panic(fmt.Errorf("invalid gRPC compressed flag: %d", flag))
+		}
+		body = body[grpcPrefixLen:]
+		if uint64(length) > uint64(len(body)) {
+			panic(fmt.Errorf("gRPC message of %d bytes is truncated to %d bytes", length, len(body)))
+		}
+		messages = append(messages, grpcMessage{compressed: flag == 1, data: body[:length]})
+		body = body[length:]
+	}
+	return messages
+}
+
+// encodeGRPCMessage percent-encodes a "Grpc-Message" value, as required by
+// the gRPC protocol for bytes outside printable ASCII and '%'.
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,7 +26,8 @@ type Middleware interface {
 	// the guest.
 	//
 	// Note: If the handler.CtxNext is returned with `next=1`, you must call
-	// HandleResponse.
+	// HandleResponse. The outCtx is only valid until then, as its state is
+	// reused by later requests.
 	HandleRequest(ctx context.Context) (outCtx context.Context, ctxNext handler.CtxNext, err error)
 
 	// HandleResponse handles a response by calling handler.FuncHandleResponse
@@ -38,10 +40,37 @@ type Middleware interface {
 	// handler.
 	HandleResponse(ctx context.Context, reqCtx uint32, err error) error
 
+	// HandleResponseBody handles a chunk of the response body by calling
+	// handler.FuncHandleResponseBody on the guest. This is only called when
+	// handler.FeatureStreamResponse is enabled for the request: once for each
+	// chunk written by the next handler, then once with endOfStream true,
+	// before HandleResponse.
+	//
+	// The ctx and reqCtx parameters are the same as HandleResponse. The host
+	// exposes the current chunk via handler.Host ResponseBodyReader.
+	HandleResponseBody(ctx context.Context, reqCtx uint32, endOfStream bool) error
+
+	// HandleRequestBody handles a chunk of the request body by calling
+	// handler.FuncHandleRequestBody on the guest. This is only called when
+	// handler.FeatureStreamRequest is enabled for the request: once for each
+	// chunk read for the next handler, then once with endOfStream true.
+	//
+	// The ctx and reqCtx parameters are the same as HandleResponse. The host
+	// exposes the current chunk via handler.Host RequestBodyReader.
+	HandleRequestBody(ctx context.Context, reqCtx uint32, endOfStream bool) error
+
 	// Features are the features enabled while initializing the guest. This
 	// value won't change per-request.
 	Features() handler.Features
 
+	// Limits are the resource limits the host enforces per request. This
+	// value won't change per-request.
+	Limits() Limits
+
+	// RewritePolicy is how the host reconciles headers after the guest
+	// overwrites a body. This value won't change per-request.
+	RewritePolicy() RewritePolicy
+
 	api.Closer
 }
 
@@ -54,24 +83,50 @@ type middleware struct {
 	moduleConfig    wazero.ModuleConfig   //模块配置
 	guestConfig     []byte                // wasm二进制文件
 	logger          api.Logger
+	limits          Limits
+	rewritePolicy   RewritePolicy
 	pool            sync.Pool
+	statePool       sync.Pool
 	features        handler.Features
 	instanceCounter uint64
+
+	// handlesResponseBody is true when the guest exports
+	// handler.FuncHandleResponseBody.
+	handlesResponseBody bool
+
+	// handlesRequestBody is true when the guest exports
+	// handler.FuncHandleRequestBody.
+	handlesRequestBody bool
 }
 
 func (m *middleware) Features() handler.Features {
 	return m.features
 }
 
+func (m *middleware) Limits() Limits {
+	return m.limits
+}
+
+func (m *middleware) RewritePolicy() RewritePolicy {
+	return m.rewritePolicy
+}
+
 func NewMiddleware(ctx context.Context, guest []byte, host handler.Host, opts ...Option) (Middleware, error) {
 	o := &options{
-		newRuntime:   DefaultRuntime,
-		moduleConfig: wazero.NewModuleConfig(),
-		logger:       api.NoopLogger{},
+		newRuntime:    DefaultRuntime,
+		moduleConfig:  wazero.NewModuleConfig().WithStartFunctions("_start", "_initialize"),
+		logger:        api.NoopLogger{},
+		limits:        defaultLimits,
+		rewritePolicy: DefaultRewritePolicy,
 	}
 	for _, opt := range opts {
 		opt(o)
 	}
+	if o.limits.MaxInFlight <= 0 {
+		return nil, fmt.Errorf("wasm: invalid MaxInFlight: %d", o.limits.MaxInFlight)
+	} else if statusCode := o.limits.RequestTooLargeStatus; statusCode < 100 || statusCode > 999 {
+		return nil, fmt.Errorf("wasm: invalid RequestTooLargeStatus: %d", statusCode)
+	}
 
 	wr, err := o.newRuntime(ctx)
 	if err != nil {
@@ -79,17 +134,21 @@ func NewMiddleware(ctx context.Context, guest []byte, host handler.Host, opts ..
 	}
 
 	m := &middleware{
-		host:         host,
-		runtime:      wr,
-		moduleConfig: o.moduleConfig,
-		guestConfig:  o.guestConfig,
-		logger:       o.logger,
+		host:          host,
+		runtime:       wr,
+		moduleConfig:  o.moduleConfig,
+		guestConfig:   o.guestConfig,
+		logger:        o.logger,
+		limits:        o.limits,
+		rewritePolicy: o.rewritePolicy,
 	}
 
 	if m.guestModule, err = m.compileGuest(ctx, guest); err != nil {
 		_ = wr.Close(ctx)
 		return nil, err
 	}
+	_, m.handlesResponseBody = m.guestModule.ExportedFunctions()[handler.FuncHandleResponseBody]
+	_, m.handlesRequestBody = m.guestModule.ExportedFunctions()[handler.FuncHandleRequestBody]
 
 	// Detect and handle any host imports or lack thereof.
 	imports := detectImports(m.guestModule.ImportedFunctions())
@@ -129,6 +188,12 @@ func (m *middleware) compileGuest(ctx context.Context, wasm []byte) (wazero.Comp
 		return nil, fmt.Errorf("wasm: guest doesn't export func[%s]", handler.FuncHandleResponse)
 	} else if !bytes.Equal(handleResponse.ParamTypes(), []wazeroapi.ValueType{wazeroapi.ValueTypeI32, wazeroapi.ValueTypeI32}) || len(handleResponse.ResultTypes()) != 0 {
 		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be (i32, 32) -> ()", handler.FuncHandleResponse)
+	} else if handleResponseBody, ok := guest.ExportedFunctions()[handler.FuncHandleResponseBody]; ok &&
+		(!bytes.Equal(handleResponseBody.ParamTypes(), []wazeroapi.ValueType{wazeroapi.ValueTypeI32, wazeroapi.ValueTypeI32}) || len(handleResponseBody.ResultTypes()) != 0) {
+		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be (i32, 32) -> ()", handler.FuncHandleResponseBody)
+	} else if handleRequestBody, ok := guest.ExportedFunctions()[handler.FuncHandleRequestBody]; ok &&
+		(!bytes.Equal(handleRequestBody.ParamTypes(), []wazeroapi.ValueType{wazeroapi.ValueTypeI32, wazeroapi.ValueTypeI32}) || len(handleRequestBody.ResultTypes()) != 0) {
+		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be (i32, 32) -> ()", handler.FuncHandleRequestBody)
 	} else if _, ok = guest.ExportedMemories()[api.Memory]; !ok {
 		return nil, fmt.Errorf("wasm: guest doesn't export memory[%s]", api.Memory)
 	} else {
@@ -144,21 +209,31 @@ func (m *middleware) HandleRequest(ctx context.Context) (outCtx context.Context,
 		return
 	}
 
-	s := &requestState{features: m.features, putPool: m.pool.Put, g: g}
+	s, _ := m.statePool.Get().(*requestState)
+	if s == nil {
+		s = &requestState{}
+	}
+	s.Context, s.features, s.m, s.g = ctx, m.features, m, g
 	defer func() {
 		if ctxNext != 0 { // will call the next handler
 			if closeErr := s.closeRequest(); err == nil {
 				err = closeErr
 			}
 		} else { // guest errored or returned the response
+			outCtx = ctx // as the state is pooled on close.
 			if closeErr := s.Close(); err == nil {
 				err = closeErr
 			}
 		}
 	}()
 
-	outCtx = context.WithValue(ctx, requestStateKey{}, s)
-	ctxNext, err = g.handleRequest(outCtx)
+	if s.features != 0 { // the host may not support all for this request.
+		s.features = m.host.EnableFeatures(ctx, s.features)
+	}
+	if ctxNext, err = g.handleRequest(s); err == nil && s.sentResponse && uint32(ctxNext) != 0 {
+		ctxNext, err = 0, fmt.Errorf("can't call next handler after %s", handler.FuncSendResponse)
+	}
+	outCtx = s
 	return
 }
 
@@ -179,10 +254,48 @@ func (m *middleware) HandleResponse(ctx context.Context, reqCtx uint32, hostErr
 	s := requestStateFromContext(ctx)
 	defer s.Close()
 	s.afterNext = true
+	s.grpcResponse = nil // the next handler produced the response.
 
 	return s.g.handleResponse(ctx, reqCtx, hostErr)
 }
 
+// HandleResponseBody implements Middleware.HandleResponseBody
+func (m *middleware) HandleResponseBody(ctx context.Context, reqCtx uint32, endOfStream bool) error {
+	s := requestStateFromContext(ctx)
+	s.afterNext = true
+	s.inResponseBody = true
+	defer func() {
+		s.inResponseBody = false
+		s.responseHeadersSent = true // the host sends them after the first chunk.
+		// Reset any body reader or writer, as they are scoped to the chunk.
+		if respBR := s.responseBodyReader; respBR != nil {
+			_ = respBR.Close()
+			s.responseBodyReader = nil
+		}
+		s.responseBodyWriter = nil
+	}()
+
+	return s.g.handleBody(ctx, s.g.handleResponseBodyFn, reqCtx, endOfStream)
+}
+
+// HandleRequestBody implements Middleware.HandleRequestBody
+func (m *middleware) HandleRequestBody(ctx context.Context, reqCtx uint32, endOfStream bool) error {
+	s := requestStateFromContext(ctx)
+	s.afterNext = true
+	s.inRequestBody = true
+	defer func() {
+		s.inRequestBody = false
+		// Reset any body reader or writer, as they are scoped to the chunk.
+		if reqBR := s.requestBodyReader; reqBR != nil {
+			_ = reqBR.Close()
+			s.requestBodyReader = nil
+		}
+		s.requestBodyWriter = nil
+	}()
+
+	return s.g.handleBody(ctx, s.g.handleRequestBodyFn, reqCtx, endOfStream)
+}
+
 // Close implements api.Closer
 func (m *middleware) Close(ctx context.Context) error {
 	// We don't have to close any guests as the middleware will close it.
@@ -190,9 +303,18 @@ func (m *middleware) Close(ctx context.Context) error {
 }
 
 type guest struct {
-	guest            wazeroapi.Module
-	handleRequestFn  wazeroapi.Function
-	handleResponseFn wazeroapi.Function
+	guest                wazeroapi.Module
+	handleRequestFn      wazeroapi.Function
+	handleResponseFn     wazeroapi.Function
+	handleResponseBodyFn wazeroapi.Function // nil when not exported
+	handleRequestBodyFn  wazeroapi.Function // nil when not exported
+
+	// stack holds the parameters and results of calls to the guest, which
+	// are serialized, so that calls don't allocate.
+	stack [2]uint64
+
+	// replaceRegexp is the last pattern compiled by FuncReplaceBody.
+	replaceRegexp *regexp.Regexp
 }
 
 func (m *middleware) newGuest(ctx context.Context) (*guest, error) {
@@ -205,18 +327,20 @@ func (m *middleware) newGuest(ctx context.Context) (*guest, error) {
 	}
 
 	return &guest{
-		guest:            g,
-		handleRequestFn:  g.ExportedFunction(handler.FuncHandleRequest),
-		handleResponseFn: g.ExportedFunction(handler.FuncHandleResponse),
+		guest:                g,
+		handleRequestFn:      g.ExportedFunction(handler.FuncHandleRequest),
+		handleResponseFn:     g.ExportedFunction(handler.FuncHandleResponse),
+		handleResponseBodyFn: g.ExportedFunction(handler.FuncHandleResponseBody),
+		handleRequestBodyFn:  g.ExportedFunction(handler.FuncHandleRequestBody),
 	}, nil
 }
 
 // handleRequest calls the WebAssembly guest function handler.FuncHandleRequest.
 func (g *guest) handleRequest(ctx context.Context) (ctxNext handler.CtxNext, err error) {
-	if results, guestErr := g.handleRequestFn.Call(ctx); guestErr != nil {
+	if guestErr := g.handleRequestFn.CallWithStack(ctx, g.stack[:]); guestErr != nil {
 		err = guestErr
 	} else {
-		ctxNext = handler.CtxNext(results[0])
+		ctxNext = handler.CtxNext(g.stack[0])
 	}
 	return
 }
@@ -227,13 +351,33 @@ func (g *guest) handleResponse(ctx context.Context, reqCtx uint32, err error) er
 	if err != nil {
 		wasError = 1
 	}
-	_, err = g.handleResponseFn.Call(ctx, uint64(reqCtx), wasError)
-	return err
+	g.stack[0], g.stack[1] = uint64(reqCtx), wasError
+	return g.handleResponseFn.CallWithStack(ctx, g.stack[:])
+}
+
+// handleBody calls the WebAssembly guest function
+// handler.FuncHandleRequestBody or handler.FuncHandleResponseBody.
+func (g *guest) handleBody(ctx context.Context, fn wazeroapi.Function, reqCtx uint32, endOfStream bool) error {
+	if fn == nil {
+		return nil // the chunk passes through
+	}
+	eos := uint64(0)
+	if endOfStream {
+		eos = 1
+	}
+	g.stack[0], g.stack[1] = uint64(reqCtx), eos
+	return fn.CallWithStack(ctx, g.stack[:])
 }
 
 // enableFeatures implements the WebAssembly host function handler.FuncEnableFeatures.
 func (m *middleware) enableFeatures(ctx context.Context, stack []uint64) {
 	features := handler.Features(stack[0])
+	if !m.handlesResponseBody { // streaming requires a guest export.
+		features &^= handler.FeatureStreamResponse
+	}
+	if !m.handlesRequestBody {
+		features &^= handler.FeatureStreamRequest
+	}
 
 	var enabled handler.Features
 	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
@@ -360,6 +504,140 @@ func (m *middleware) setURI(ctx context.Context, mod wazeroapi.Module, params []
 	m.host.SetURI(ctx, p)
 }
 
+// getQueryNames implements the WebAssembly host function
+// handler.FuncGetQueryNames.
+func (m *middleware) getQueryNames(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	names := m.host.GetQueryNames(ctx)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, names)
+
+	stack[0] = countLen
+}
+
+// getQueryValues implements the WebAssembly host function
+// handler.FuncGetQueryValues.
+func (m *middleware) getQueryValues(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	name := uint32(stack[0])
+	nameLen := uint32(stack[1])
+	buf := uint32(stack[2])
+	bufLimit := handler.BufLimit(stack[3])
+
+	if nameLen == 0 {
+		panic("HTTP query parameter name cannot be empty")
+	}
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	values := m.host.GetQueryValues(ctx, n)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, values)
+
+	stack[0] = countLen
+}
+
+// setQueryValue implements the WebAssembly host function
+// handler.FuncSetQueryValue.
+func (m *middleware) setQueryValue(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+	value := uint32(params[2])
+	valueLen := uint32(params[3])
+
+	if nameLen == 0 {
+		panic("HTTP query parameter name cannot be empty")
+	}
+	_ = mustBeforeNext(ctx, "set", "query parameter")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+	v := mustReadString(mod.Memory(), "value", value, valueLen)
+
+	m.host.SetQueryValue(ctx, n, v)
+}
+
+// addQueryValue implements the WebAssembly host function
+// handler.FuncAddQueryValue.
+func (m *middleware) addQueryValue(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+	value := uint32(params[2])
+	valueLen := uint32(params[3])
+
+	if nameLen == 0 {
+		panic("HTTP query parameter name cannot be empty")
+	}
+	_ = mustBeforeNext(ctx, "add", "query parameter")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+	v := mustReadString(mod.Memory(), "value", value, valueLen)
+
+	m.host.AddQueryValue(ctx, n, v)
+}
+
+// removeQuery implements the WebAssembly host function
+// handler.FuncRemoveQuery.
+func (m *middleware) removeQuery(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+
+	if nameLen == 0 {
+		panic("HTTP query parameter name cannot be empty")
+	}
+	_ = mustBeforeNext(ctx, "remove", "query parameter")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	m.host.RemoveQuery(ctx, n)
+}
+
+// getScheme implements the WebAssembly host function handler.FuncGetScheme.
+func (m *middleware) getScheme(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	scheme := m.host.GetScheme(ctx)
+	schemeLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, scheme)
+
+	stack[0] = uint64(schemeLen)
+}
+
+// setScheme implements the WebAssembly host function handler.FuncSetScheme.
+func (m *middleware) setScheme(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	scheme := uint32(params[0])
+	schemeLen := uint32(params[1])
+
+	_ = mustBeforeNext(ctx, "set", "scheme")
+
+	if schemeLen == 0 {
+		panic("HTTP scheme cannot be empty")
+	}
+	p := mustReadString(mod.Memory(), "scheme", scheme, schemeLen)
+	m.host.SetScheme(ctx, p)
+}
+
+// getAuthority implements the WebAssembly host function
+// handler.FuncGetAuthority.
+func (m *middleware) getAuthority(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	authority := m.host.GetAuthority(ctx)
+	authorityLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, authority)
+
+	stack[0] = uint64(authorityLen)
+}
+
+// setAuthority implements the WebAssembly host function
+// handler.FuncSetAuthority.
+func (m *middleware) setAuthority(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	authority := uint32(params[0])
+	authorityLen := uint32(params[1])
+
+	_ = mustBeforeNext(ctx, "set", "authority")
+
+	var p string
+	if authorityLen > 0 { // overwrite with empty is supported
+		p = mustReadString(mod.Memory(), "authority", authority, authorityLen)
+	}
+	m.host.SetAuthority(ctx, p)
+}
+
 // getProtocolVersion implements the WebAssembly host function
 // handler.FuncGetProtocolVersion.
 func (m *middleware) getProtocolVersion(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
@@ -382,28 +660,8 @@ func (m *middleware) getHeaderNames(ctx context.Context, mod wazeroapi.Module, s
 	buf := uint32(stack[1])
 	bufLimit := handler.BufLimit(stack[2])
 
-	var names []string
-	switch kind {
-	case handler.HeaderKindRequest:
-		names = m.host.GetRequestHeaderNames(ctx)
-	case handler.HeaderKindRequestTrailers:
-		names = m.host.GetRequestTrailerNames(ctx)
-	case handler.HeaderKindResponse:
-		names = m.host.GetResponseHeaderNames(ctx)
-	case handler.HeaderKindResponseTrailers:
-		names = m.host.GetResponseTrailerNames(ctx)
-	default:
-		panic("unsupported header kind: " + strconv.Itoa(int(kind)))
-	}
-
-	// TODO: This will allocate new strings all the time. It could be optimized
-	// by having writeNULTerminated directly lowercase while writing instead for
-	// this code path.
-	for i := range names {
-		names[i] = strings.ToLower(names[i])
-	}
-
-	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, names)
+	names := m.headerNames(ctx, kind)
+	countLen := writeNULTerminatedLower(ctx, mod.Memory(), buf, bufLimit, names, 1)
 
 	stack[0] = countLen
 }
@@ -422,22 +680,87 @@ func (m *middleware) getHeaderValues(ctx context.Context, mod wazeroapi.Module,
 	}
 	n := mustReadString(mod.Memory(), "name", name, nameLen)
 
-	var values []string
+	values := m.headerValues(ctx, kind, n)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, values)
+
+	stack[0] = countLen
+}
+
+// getHeaders implements the WebAssembly host function handler.FuncGetHeaders.
+func (m *middleware) getHeaders(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	kind := handler.HeaderKind(stack[0])
+	buf := uint32(stack[1])
+	bufLimit := handler.BufLimit(stack[2])
+
+	names := m.headerNames(ctx, kind)
+	fields := make([]string, 0, 2*len(names))
+	for _, n := range names {
+		for _, v := range m.headerValues(ctx, kind, n) {
+			fields = append(fields, n, v)
+		}
+	}
+	countLen := writeNULTerminatedLower(ctx, mod.Memory(), buf, bufLimit, fields, 2)
+
+	stack[0] = countLen
+}
+
+// setHeaders implements the WebAssembly host function handler.FuncSetHeaders.
+func (m *middleware) setHeaders(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	kind := handler.HeaderKind(params[0])
+	headers := uint32(params[1])
+	headersLen := uint32(params[2])
+
+	mustHeaderMutable(ctx, "set", kind)
+	fields := mustParseHeaderBlock(mustReadString(mod.Memory(), "headers", headers, headersLen))
+	m.setHeaderFields(ctx, kind, fields)
+}
+
+// setHeaderFields applies alternating header names and values, parsed by
+// mustParseHeaderBlock. The first value of a header replaces any existing,
+// and the rest are added.
+func (m *middleware) setHeaderFields(ctx context.Context, kind handler.HeaderKind, fields []string) {
+	replaced := make(map[string]bool, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		n, v := fields[i], fields[i+1]
+		if key := strings.ToLower(n); replaced[key] {
+			m.addHeader(ctx, kind, n, v)
+		} else {
+			replaced[key] = true
+			m.setHeader(ctx, kind, n, v)
+		}
+	}
+}
+
+// headerNames returns the names of all headers of the given kind.
+func (m *middleware) headerNames(ctx context.Context, kind handler.HeaderKind) []string {
 	switch kind {
 	case handler.HeaderKindRequest:
-		values = m.host.GetRequestHeaderValues(ctx, n)
+		return m.host.GetRequestHeaderNames(ctx)
 	case handler.HeaderKindRequestTrailers:
-		values = m.host.GetRequestTrailerValues(ctx, n)
+		return m.host.GetRequestTrailerNames(ctx)
 	case handler.HeaderKindResponse:
-		values = m.host.GetResponseHeaderValues(ctx, n)
+		return m.host.GetResponseHeaderNames(ctx)
 	case handler.HeaderKindResponseTrailers:
-		values = m.host.GetResponseTrailerValues(ctx, n)
+		return m.host.GetResponseTrailerNames(ctx)
 	default:
 		panic("unsupported header kind: " + strconv.Itoa(int(kind)))
 	}
-	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, values)
+}
 
-	stack[0] = countLen
+// headerValues returns the values of the header of the given kind and name.
+func (m *middleware) headerValues(ctx context.Context, kind handler.HeaderKind, n string) []string {
+	switch kind {
+	case handler.HeaderKindRequest:
+		return m.host.GetRequestHeaderValues(ctx, n)
+	case handler.HeaderKindRequestTrailers:
+		return m.host.GetRequestTrailerValues(ctx, n)
+	case handler.HeaderKindResponse:
+		return m.host.GetResponseHeaderValues(ctx, n)
+	case handler.HeaderKindResponseTrailers:
+		return m.host.GetResponseTrailerValues(ctx, n)
+	default:
+		panic("unsupported header kind: " + strconv.Itoa(int(kind)))
+	}
 }
 
 // setHeaderValue implements the WebAssembly host function
@@ -456,6 +779,11 @@ func (m *middleware) setHeaderValue(ctx context.Context, mod wazeroapi.Module, p
 	n := mustReadString(mod.Memory(), "name", name, nameLen)
 	v := mustReadString(mod.Memory(), "value", value, valueLen)
 
+	m.setHeader(ctx, kind, n, v)
+}
+
+// setHeader replaces any values of the header of the given kind and name.
+func (m *middleware) setHeader(ctx context.Context, kind handler.HeaderKind, n, v string) {
 	switch kind {
 	case handler.HeaderKindRequest:
 		m.host.SetRequestHeaderValue(ctx, n, v)
@@ -486,6 +814,11 @@ func (m *middleware) addHeaderValue(ctx context.Context, mod wazeroapi.Module, p
 	n := mustReadString(mod.Memory(), "name", name, nameLen)
 	v := mustReadString(mod.Memory(), "value", value, valueLen)
 
+	m.addHeader(ctx, kind, n, v)
+}
+
+// addHeader adds a value to the header of the given kind and name.
+func (m *middleware) addHeader(ctx context.Context, kind handler.HeaderKind, n, v string) {
 	switch kind {
 	case handler.HeaderKindRequest:
 		m.host.AddRequestHeaderValue(ctx, n, v)
@@ -527,37 +860,310 @@ func (m *middleware) removeHeader(ctx context.Context, mod wazeroapi.Module, par
 	}
 }
 
+// getCookieNames implements the WebAssembly host function
+// handler.FuncGetCookieNames.
+func (m *middleware) getCookieNames(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	names := m.host.GetRequestCookieNames(ctx)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, names)
+
+	stack[0] = countLen
+}
+
+// getCookieValues implements the WebAssembly host function
+// handler.FuncGetCookieValues.
+func (m *middleware) getCookieValues(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	name := uint32(stack[0])
+	nameLen := uint32(stack[1])
+	buf := uint32(stack[2])
+	bufLimit := handler.BufLimit(stack[3])
+
+	if nameLen == 0 {
+		panic("HTTP cookie name cannot be empty")
+	}
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	values := m.host.GetRequestCookieValues(ctx, n)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, values)
+
+	stack[0] = countLen
+}
+
+// setCookie implements the WebAssembly host function handler.FuncSetCookie.
+func (m *middleware) setCookie(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+	value := uint32(params[2])
+	valueLen := uint32(params[3])
+	path := uint32(params[4])
+	pathLen := uint32(params[5])
+	domain := uint32(params[6])
+	domainLen := uint32(params[7])
+	maxAge := int32(params[8])
+	flags := handler.CookieFlags(params[9])
+
+	if nameLen == 0 {
+		panic("HTTP cookie name cannot be empty")
+	}
+	sameSite := flags & (handler.CookieFlagSameSiteLax | handler.CookieFlagSameSiteStrict | handler.CookieFlagSameSiteNone)
+	if sameSite&(sameSite-1) != 0 {
+		panic("HTTP cookie can only have one SameSite attribute")
+	}
+	mustHeaderMutable(ctx, "set", handler.HeaderKindResponse)
+
+	m.host.SetResponseCookie(ctx, handler.Cookie{
+		Name:   mustReadString(mod.Memory(), "name", name, nameLen),
+		Value:  mustReadString(mod.Memory(), "value", value, valueLen),
+		Path:   mustReadString(mod.Memory(), "path", path, pathLen),
+		Domain: mustReadString(mod.Memory(), "domain", domain, domainLen),
+		MaxAge: maxAge,
+		Flags:  flags,
+	})
+}
+
+// deleteCookie implements the WebAssembly host function
+// handler.FuncDeleteCookie.
+func (m *middleware) deleteCookie(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+	path := uint32(params[2])
+	pathLen := uint32(params[3])
+	domain := uint32(params[4])
+	domainLen := uint32(params[5])
+
+	if nameLen == 0 {
+		panic("HTTP cookie name cannot be empty")
+	}
+	mustHeaderMutable(ctx, "delete", handler.HeaderKindResponse)
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+	p := mustReadString(mod.Memory(), "path", path, pathLen)
+	d := mustReadString(mod.Memory(), "domain", domain, domainLen)
+
+	m.host.DeleteResponseCookie(ctx, n, p, d)
+}
+
+// getFormNames implements the WebAssembly host function
+// handler.FuncGetFormNames.
+func (m *middleware) getFormNames(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	names := sortedKeys(m.mustForm(ctx).Value)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, names)
+
+	stack[0] = countLen
+}
+
+// getFormValues implements the WebAssembly host function
+// handler.FuncGetFormValues.
+func (m *middleware) getFormValues(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	name := uint32(stack[0])
+	nameLen := uint32(stack[1])
+	buf := uint32(stack[2])
+	bufLimit := handler.BufLimit(stack[3])
+
+	if nameLen == 0 {
+		panic("HTTP form field name cannot be empty")
+	}
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	values := m.mustForm(ctx).Value[n]
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, values)
+
+	stack[0] = countLen
+}
+
+// getFormFileNames implements the WebAssembly host function
+// handler.FuncGetFormFileNames.
+func (m *middleware) getFormFileNames(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	names := sortedKeys(m.mustForm(ctx).File)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, names)
+
+	stack[0] = countLen
+}
+
+// getFormFileHeaders implements the WebAssembly host function
+// handler.FuncGetFormFileHeaders.
+func (m *middleware) getFormFileHeaders(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	name := uint32(stack[0])
+	nameLen := uint32(stack[1])
+	index := uint32(stack[2])
+	buf := uint32(stack[3])
+	bufLimit := handler.BufLimit(stack[4])
+
+	if nameLen == 0 {
+		panic("HTTP form field name cannot be empty")
+	}
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	headers := formFileHeaders(m.mustForm(ctx), n, index)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, headers)
+
+	stack[0] = countLen
+}
+
+// getGRPCMessageCount implements the WebAssembly host function
+// handler.FuncGetGRPCMessageCount.
+func (m *middleware) getGRPCMessageCount(ctx context.Context, stack []uint64) {
+	kind := handler.BodyKind(stack[0])
+
+	count := len(m.mustGRPCMessages(ctx, kind))
+
+	stack[0] = uint64(count)
+}
+
+// readGRPCMessage implements the WebAssembly host function
+// handler.FuncReadGRPCMessage.
+func (m *middleware) readGRPCMessage(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	kind := handler.BodyKind(stack[0])
+	index := uint32(stack[1])
+	buf := uint32(stack[2])
+	bufLimit := handler.BufLimit(stack[3])
+
+	messages := m.mustGRPCMessages(ctx, kind)
+	if index >= uint32(len(messages)) {
+		panic(fmt.Errorf("gRPC message index %d out of range: %d messages", index, len(messages)))
+	}
+	message := messages[index]
+	compressedLen := uint64(writeIfUnderLimit(mod.Memory(), buf, bufLimit, message.data))
+	if message.compressed {
+		compressedLen |= uint64(1) << 32
+	}
+
+	stack[0] = compressedLen
+}
+
+// maxGRPCStatus is the highest gRPC status code, UNAUTHENTICATED.
+const maxGRPCStatus = 16
+
+// sendGRPCStatus implements the WebAssembly host function
+// handler.FuncSendGRPCStatus.
+func (m *middleware) sendGRPCStatus(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	code := uint32(params[0])
+	message := uint32(params[1])
+	messageLen := uint32(params[2])
+
+	if code > maxGRPCStatus {
+		panic(fmt.Errorf("invalid gRPC status code: %d", code))
+	}
+	s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "send", "gRPC status")
+	msg := mustReadString(mod.Memory(), "message", message, messageLen)
+
+	m.host.SetResponseHeaderValue(ctx, "Content-Type", "application/grpc")
+	m.host.SetResponseHeaderValue(ctx, "Grpc-Status", strconv.FormatUint(uint64(code), 10))
+	if msg != "" {
+		m.host.SetResponseHeaderValue(ctx, "Grpc-Message", encodeGRPCMessage(msg))
+	} else {
+		m.host.RemoveResponseHeader(ctx, "Grpc-Message")
+	}
+	// Set last, as a host may send the headers with the status code.
+	m.host.SetStatusCode(ctx, 200) // gRPC statuses are sent with HTTP 200.
+
+	if s.afterNext { // replace the response of the next handler.
+		s.responseBodyWriter = m.host.ResponseBodyWriter(ctx) // resets the body.
+		s.grpcResponse = nil
+		if s.features.IsEnabled(handler.FeatureTrailers) {
+			m.host.RemoveResponseTrailer(ctx, "Grpc-Status")
+			m.host.RemoveResponseTrailer(ctx, "Grpc-Message")
+		}
+	}
+}
+
 // readBody implements the WebAssembly host function handler.FuncReadBody.
 func (m *middleware) readBody(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
 	kind := handler.BodyKind(stack[0])
 	buf := uint32(stack[1])
 	bufLimit := handler.BufLimit(stack[2])
 
-	var r io.ReadCloser
+	r := m.mustBodyReader(ctx, kind)
+	eofLen := readBody(mod, buf, bufLimit, r)
+
+	stack[0] = eofLen
+}
+
+// bodyLen implements the WebAssembly host function handler.FuncBodyLen.
+func (m *middleware) bodyLen(ctx context.Context, stack []uint64) {
+	kind := handler.BodyKind(stack[0])
+
+	length := int64(-1)
+	if r, ok := m.mustBodyReader(ctx, kind).(*bytesBodyReader); ok {
+		length = int64(len(r.b))
+	}
+
+	stack[0] = uint64(length)
+}
+
+// mustBodyReader returns the reader of the BodyKind body, creating it on
+// first use. This panics if the body can't be read now.
+func (m *middleware) mustBodyReader(ctx context.Context, kind handler.BodyKind) io.ReadCloser {
 	switch kind {
 	case handler.BodyKindRequest:
-		s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferRequest, "read", "request body")
+		s := requestStateFromContext(ctx)
+		if !s.inRequestBody {
+			_ = mustBeforeNextOrFeature(ctx, handler.FeatureBufferRequest, "read", "request body")
+		}
 		// Lazy create the reader.
-		r = s.requestBodyReader
-		if r == nil {
-			r = m.host.RequestBodyReader(ctx)
-			s.requestBodyReader = r
+		if s.requestBodyReader == nil {
+			s.requestBodyReader = m.newBodyReader(ctx, s, kind)
 		}
+		return s.requestBodyReader
 	case handler.BodyKindResponse:
-		s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "read", "response body")
+		s := mustResponseBodyAccessible(ctx, "read")
 		// Lazy create the reader.
-		r = s.responseBodyReader
-		if r == nil {
-			r = m.host.ResponseBodyReader(ctx)
-			s.responseBodyReader = r
+		if s.responseBodyReader == nil {
+			s.responseBodyReader = m.newBodyReader(ctx, s, kind)
 		}
+		return s.responseBodyReader
 	default:
 		panic("unsupported body kind: " + strconv.Itoa(int(kind)))
 	}
+}
 
-	eofLen := readBody(mod, buf, bufLimit, r)
+// newBodyReader returns a reader of the BodyKind body, which reads the bytes
+// directly when the host holds the body in memory.
+func (m *middleware) newBodyReader(ctx context.Context, s *requestState, kind handler.BodyKind) io.ReadCloser {
+	h, _ := m.host.(handler.BodyBytesHost)
+	if kind == handler.BodyKindRequest {
+		if h != nil {
+			if b, ok := h.RequestBodyBytes(ctx); ok {
+				s.requestBodyBytes.b = b
+				return &s.requestBodyBytes
+			}
+		}
+		return m.host.RequestBodyReader(ctx)
+	}
+	if h != nil {
+		if b, ok := h.ResponseBodyBytes(ctx); ok {
+			s.responseBodyBytes.b = b
+			return &s.responseBodyBytes
+		}
+	}
+	return m.host.ResponseBodyReader(ctx)
+}
 
-	stack[0] = eofLen
+// bytesBodyReader reads a body a handler.BodyBytesHost holds in memory.
+// readBody copies it into memory directly.
+type bytesBodyReader struct{ b []byte }
+
+// Read implements io.Reader
+func (r *bytesBodyReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
+
+// Close implements io.Closer
+func (r *bytesBodyReader) Close() error {
+	r.b = nil // don't retain the body.
+	return nil
 }
 
 // writeBody implements the WebAssembly host function handler.FuncWriteBody.
@@ -569,7 +1175,11 @@ func (m *middleware) writeBody(ctx context.Context, mod wazeroapi.Module, params
 	var w io.Writer
 	switch kind {
 	case handler.BodyKindRequest:
-		s := mustBeforeNext(ctx, "write", "request body")
+		s := requestStateFromContext(ctx)
+		if !s.inRequestBody {
+			_ = mustBeforeNext(ctx, "write", "request body")
+		}
+		s.grpcRequest = nil // the body changes.
 		// Lazy create the writer.
 		w = s.requestBodyWriter
 		if w == nil {
@@ -577,10 +1187,17 @@ func (m *middleware) writeBody(ctx context.Context, mod wazeroapi.Module, params
 			s.requestBodyWriter = w
 		}
 	case handler.BodyKindResponse:
-		s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "write", "response body")
+		s := mustResponseBodyAccessible(ctx, "write")
+		if s.sentResponse {
+			panic(fmt.Errorf("can't write response body after %s", handler.FuncSendResponse))
+		}
+		s.grpcResponse = nil // the body changes.
 		// Lazy create the writer.
 		w = s.responseBodyWriter
 		if w == nil {
+			if s.inResponseBody { // the host sends headers before the body.
+				s.responseHeadersSent = true
+			}
 			w = m.host.ResponseBodyWriter(ctx)
 			s.responseBodyWriter = w
 		}
@@ -615,11 +1232,174 @@ func (m *middleware) getStatusCode(ctx context.Context, results []uint64) {
 func (m *middleware) setStatusCode(ctx context.Context, params []uint64) {
 	statusCode := uint32(params[0])
 
-	_ = mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "set", "status code")
+	_ = mustResponseHeaderMutable(ctx, "set", "status code")
+	if statusCode < 100 || statusCode > 999 {
+		panic(&handler.StatusCodeError{StatusCode: statusCode})
+	}
 
 	m.host.SetStatusCode(ctx, statusCode)
 }
 
+// setReasonPhrase implements the WebAssembly host function
+// handler.FuncSetReasonPhrase.
+func (m *middleware) setReasonPhrase(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	reason := uint32(params[0])
+	reasonLen := uint32(params[1])
+
+	_ = mustResponseHeaderMutable(ctx, "set", "reason phrase")
+	h, ok := m.host.(handler.ReasonPhraseHost)
+	if !ok {
+		panic("host doesn't support reason phrases")
+	}
+
+	p := mustReadString(mod.Memory(), "reason phrase", reason, reasonLen)
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			panic(fmt.Errorf("invalid reason phrase: %q", p))
+		}
+	}
+	h.SetReasonPhrase(ctx, p)
+}
+
+// sendInformational implements the WebAssembly host function
+// handler.FuncSendInformational.
+func (m *middleware) sendInformational(ctx context.Context, params []uint64) {
+	statusCode := uint32(params[0])
+
+	_ = mustBeforeNext(ctx, "send", "informational response")
+	if statusCode < 100 || statusCode > 199 || statusCode == 101 {
+		panic(&handler.StatusCodeError{StatusCode: statusCode})
+	}
+	h, ok := m.host.(handler.InformationalHost)
+	if !ok {
+		panic("host doesn't support informational responses")
+	}
+
+	h.SendInformational(ctx, statusCode)
+}
+
+// sendResponse implements the WebAssembly host function
+// handler.FuncSendResponse.
+func (m *middleware) sendResponse(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	statusCode := uint32(params[0])
+	headers := uint32(params[1])
+	headersLen := uint32(params[2])
+	body := uint32(params[3])
+	bodyLen := uint32(params[4])
+
+	s := mustBeforeNext(ctx, "send", "response")
+	if s.sentResponse {
+		panic(fmt.Errorf("can't call %s more than once", handler.FuncSendResponse))
+	} else if statusCode < 100 || statusCode > 999 {
+		panic(&handler.StatusCodeError{StatusCode: statusCode})
+	} else if h, ok := m.host.(handler.ResponseSentHost); ok && h.ResponseHeadersSent(ctx) {
+		panic(fmt.Errorf("can't call %s after the response headers were sent", handler.FuncSendResponse))
+	}
+
+	// Validate everything before changing the response, so that a trap never
+	// leaves it partially written.
+	fields := mustParseHeaderBlock(mustReadString(mod.Memory(), "headers", headers, headersLen))
+	var b []byte
+	if bodyLen > 0 {
+		b = mustRead(mod.Memory(), "body", body, bodyLen)
+	}
+	s.sentResponse = true
+	s.grpcResponse = nil // the body changes.
+
+	// Headers precede the status code, which some hosts send at once.
+	m.setHeaderFields(ctx, handler.HeaderKindResponse, fields)
+	m.host.SetStatusCode(ctx, statusCode)
+	if len(b) > 0 {
+		if _, err := m.host.ResponseBodyWriter(ctx).Write(b); err != nil {
+			panic(fmt.Errorf("error writing body: %w", err))
+		}
+	}
+}
+
+// getRemoteAddr implements the WebAssembly host function
+// handler.FuncGetRemoteAddr.
+func (m *middleware) getRemoteAddr(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	addr := m.host.GetRemoteAddr(ctx)
+	addrLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, addr)
+
+	stack[0] = uint64(addrLen)
+}
+
+// getLocalAddr implements the WebAssembly host function
+// handler.FuncGetLocalAddr.
+func (m *middleware) getLocalAddr(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	addr := m.host.GetLocalAddr(ctx)
+	addrLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, addr)
+
+	stack[0] = uint64(addrLen)
+}
+
+// getTLSVersion implements the WebAssembly host function
+// handler.FuncGetTLSVersion.
+func (m *middleware) getTLSVersion(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	version := m.host.GetTLSVersion(ctx)
+	versionLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, version)
+
+	stack[0] = uint64(versionLen)
+}
+
+// getTLSCipherSuite implements the WebAssembly host function
+// handler.FuncGetTLSCipherSuite.
+func (m *middleware) getTLSCipherSuite(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	cipherSuite := m.host.GetTLSCipherSuite(ctx)
+	cipherSuiteLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, cipherSuite)
+
+	stack[0] = uint64(cipherSuiteLen)
+}
+
+// getTLSServerName implements the WebAssembly host function
+// handler.FuncGetTLSServerName.
+func (m *middleware) getTLSServerName(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	serverName := m.host.GetTLSServerName(ctx)
+	serverNameLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, serverName)
+
+	stack[0] = uint64(serverNameLen)
+}
+
+// getTLSPeerSubject implements the WebAssembly host function
+// handler.FuncGetTLSPeerSubject.
+func (m *middleware) getTLSPeerSubject(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	subject := m.host.GetTLSPeerSubject(ctx)
+	subjectLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, subject)
+
+	stack[0] = uint64(subjectLen)
+}
+
+// getTLSPeerSANs implements the WebAssembly host function
+// handler.FuncGetTLSPeerSANs.
+func (m *middleware) getTLSPeerSANs(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	sans := m.host.GetTLSPeerSANs(ctx)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, sans)
+
+	stack[0] = countLen
+}
+
 func readBody(mod wazeroapi.Module, buf uint32, bufLimit handler.BufLimit, r io.Reader) (eofLen uint64) {
 	// buf_limit 0 serves no purpose as implementations won't return EOF on it.
 	if bufLimit == 0 {
@@ -629,6 +1409,16 @@ func readBody(mod wazeroapi.Module, buf uint32, bufLimit handler.BufLimit, r io.
 	// Allocate a buf to write into directly
 	b := mustRead(mod.Memory(), "body", buf, bufLimit)
 
+	// Copy a body held in memory at once, returning EOF with the last bytes.
+	if br, ok := r.(*bytesBodyReader); ok {
+		n := copy(b, br.b)
+		br.b = br.b[n:]
+		if len(br.b) == 0 {
+			return uint64(1<<32) | uint64(n)
+		}
+		return uint64(n)
+	}
+
 	// Attempt to fill the buffer until an error occurs. Notably, this works
 	// around a full read not returning EOF until the
 	var err error
@@ -667,6 +1457,52 @@ func mustBeforeNextOrFeature(ctx context.Context, feature handler.Features, op,
 	return
 }
 
+// mustResponseHeaderMutable panics unless the response status code or headers
+// can still be changed. After the next handler, this requires buffering, or
+// streaming before the headers were sent.
+func mustResponseHeaderMutable(ctx context.Context, op, kind string) (s *requestState) {
+	if s = requestStateFromContext(ctx); s.sentResponse {
+		panic(fmt.Errorf("can't %s %s after %s", op, kind, handler.FuncSendResponse))
+	} else if !s.afterNext || s.features.IsEnabled(handler.FeatureBufferResponse) {
+		return
+	} else if s.features.IsEnabled(handler.FeatureStreamResponse) {
+		if s.responseHeadersSent {
+			panic(fmt.Errorf("can't %s %s after it was sent", op, kind))
+		}
+		return
+	}
+	panic(fmt.Errorf("can't %s %s after next handler unless %s is enabled",
+		op, kind, handler.FeatureBufferResponse))
+}
+
+// mustResponseTrailerMutable panics unless response trailers can be changed.
+// After the next handler, this requires buffering or streaming, as trailers
+// are sent after the body.
+func mustResponseTrailerMutable(ctx context.Context, op string) (s *requestState) {
+	if s = requestStateFromContext(ctx); !s.afterNext ||
+		s.features.IsEnabled(handler.FeatureBufferResponse|handler.FeatureStreamResponse) {
+		return
+	}
+	panic(fmt.Errorf("can't %s response trailer after next handler unless %s is enabled",
+		op, handler.FeatureBufferResponse))
+}
+
+// mustResponseBodyAccessible panics unless the response body can be read or
+// written. After the next handler, this requires buffering, or streaming
+// inside handler.FuncHandleResponseBody.
+func mustResponseBodyAccessible(ctx context.Context, op string) (s *requestState) {
+	if s = requestStateFromContext(ctx); !s.afterNext || s.features.IsEnabled(handler.FeatureBufferResponse) {
+		return
+	} else if s.features.IsEnabled(handler.FeatureStreamResponse) {
+		if !s.inResponseBody {
+			panic(fmt.Errorf("can't %s response body outside %s", op, handler.FuncHandleResponseBody))
+		}
+		return
+	}
+	panic(fmt.Errorf("can't %s response body after next handler unless %s is enabled",
+		op, handler.FeatureBufferResponse))
+}
+
 const i32, i64 = wazeroapi.ValueTypeI32, wazeroapi.ValueTypeI64
 
 func (m *middleware) instantiateHost(ctx context.Context) (wazeroapi.Module, error) {
@@ -704,6 +1540,33 @@ func (m *middleware) instantiateHost(ctx context.Context) (wazeroapi.Module, err
 		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setURI), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("uri", "uri_len").Export(handler.FuncSetURI).
 		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getQueryNames), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetQueryNames).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getQueryValues), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("name", "name_len", "buf", "buf_limit").Export(handler.FuncGetQueryValues).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setQueryValue), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len", "value", "value_len").Export(handler.FuncSetQueryValue).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.addQueryValue), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len", "value", "value_len").Export(handler.FuncAddQueryValue).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.removeQuery), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len").Export(handler.FuncRemoveQuery).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getScheme), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetScheme).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setScheme), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("scheme", "scheme_len").Export(handler.FuncSetScheme).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getAuthority), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetAuthority).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setAuthority), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("authority", "authority_len").Export(handler.FuncSetAuthority).
+		NewFunctionBuilder().
 		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getProtocolVersion), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetProtocolVersion).
 		NewFunctionBuilder().
@@ -722,17 +1585,92 @@ func (m *middleware) instantiateHost(ctx context.Context) (wazeroapi.Module, err
 		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.removeHeader), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("kind", "name", "name_len").Export(handler.FuncRemoveHeader).
 		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getHeaders), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("kind", "buf", "buf_limit").Export(handler.FuncGetHeaders).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setHeaders), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("kind", "headers", "headers_len").Export(handler.FuncSetHeaders).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getCookieNames), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetCookieNames).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getCookieValues), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("name", "name_len", "buf", "buf_limit").Export(handler.FuncGetCookieValues).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setCookie), []wazeroapi.ValueType{i32, i32, i32, i32, i32, i32, i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len", "value", "value_len", "path", "path_len", "domain", "domain_len", "max_age", "flags").Export(handler.FuncSetCookie).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.deleteCookie), []wazeroapi.ValueType{i32, i32, i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len", "path", "path_len", "domain", "domain_len").Export(handler.FuncDeleteCookie).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getFormNames), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetFormNames).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getFormValues), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("name", "name_len", "buf", "buf_limit").Export(handler.FuncGetFormValues).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getFormFileNames), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetFormFileNames).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getFormFileHeaders), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("name", "name_len", "index", "buf", "buf_limit").Export(handler.FuncGetFormFileHeaders).
+		NewFunctionBuilder().
+		WithGoFunction(wazeroapi.GoFunc(m.getGRPCMessageCount), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("kind").Export(handler.FuncGetGRPCMessageCount).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.readGRPCMessage), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("kind", "index", "buf", "buf_limit").Export(handler.FuncReadGRPCMessage).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.sendGRPCStatus), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("code", "message", "message_len").Export(handler.FuncSendGRPCStatus).
+		NewFunctionBuilder().
 		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.readBody), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{i64}).
 		WithParameterNames("kind", "buf", "buf_limit").Export(handler.FuncReadBody).
 		NewFunctionBuilder().
+		WithGoFunction(wazeroapi.GoFunc(m.bodyLen), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("kind").Export(handler.FuncBodyLen).
+		NewFunctionBuilder().
 		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.writeBody), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("kind", "body", "body_len").Export(handler.FuncWriteBody).
 		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.replaceBody), []wazeroapi.ValueType{i32, i32, i32, i32, i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("kind", "flags", "pattern", "pattern_len", "replacement", "replacement_len").Export(handler.FuncReplaceBody).
+		NewFunctionBuilder().
 		WithGoFunction(wazeroapi.GoFunc(m.getStatusCode), []wazeroapi.ValueType{}, []wazeroapi.ValueType{i32}).
 		WithParameterNames().Export(handler.FuncGetStatusCode).
 		NewFunctionBuilder().
 		WithGoFunction(wazeroapi.GoFunc(m.setStatusCode), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("status_code").Export(handler.FuncSetStatusCode).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setReasonPhrase), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("reason", "reason_len").Export(handler.FuncSetReasonPhrase).
+		NewFunctionBuilder().
+		WithGoFunction(wazeroapi.GoFunc(m.sendInformational), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("status_code").Export(handler.FuncSendInformational).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.sendResponse), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("status_code", "headers", "headers_len", "body", "body_len").Export(handler.FuncSendResponse).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getRemoteAddr), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetRemoteAddr).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getLocalAddr), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetLocalAddr).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getTLSVersion), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetTLSVersion).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getTLSCipherSuite), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetTLSCipherSuite).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getTLSServerName), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetTLSServerName).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getTLSPeerSubject), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetTLSPeerSubject).
+		NewFunctionBuilder().
+		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getTLSPeerSANs), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetTLSPeerSANs).
 		Instantiate(ctx)
 }
 
@@ -743,9 +1681,9 @@ func mustHeaderMutable(ctx context.Context, op string, kind handler.HeaderKind)
 	case handler.HeaderKindRequestTrailers:
 		_ = mustBeforeNext(ctx, op, "request trailer")
 	case handler.HeaderKindResponse:
-		_ = mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, op, "response header")
+		_ = mustResponseHeaderMutable(ctx, op, "response header")
 	case handler.HeaderKindResponseTrailers:
-		_ = mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, op, "response trailer")
+		_ = mustResponseTrailerMutable(ctx, op)
 	default:
 		panic("unsupported header kind: " + strconv.Itoa(int(kind)))
 	}
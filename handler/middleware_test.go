@@ -3,7 +3,10 @@ package handler
 import (
 	"context"
 	_ "embed"
+	"encoding/binary"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/httpwasm/http-wasm-host-go/api/handler"
@@ -163,7 +166,7 @@ func requireGlobals(t *testing.T, mw Middleware, wantGlobals ...uint64) {
 }
 
 func getGlobalVals(mw Middleware) []uint64 {
-	pool := mw.(*middleware).pool
+	pool := &mw.(*middleware).pool
 	var guests []*guest
 	var globals []uint64
 
@@ -207,3 +210,211 @@ func requireEqualError(t *testing.T, err error, expectedError string) {
 		t.Fatalf("expected error %v", want)
 	}
 }
+
+// reasonPhraseHost records the status code and reason phrase set by the
+// guest.
+type reasonPhraseHost struct {
+	handler.UnimplementedHost
+	statusCode uint32
+	reason     string
+}
+
+func (h *reasonPhraseHost) SetStatusCode(_ context.Context, statusCode uint32) {
+	h.statusCode = statusCode
+}
+
+func (h *reasonPhraseHost) SetReasonPhrase(_ context.Context, reason string) {
+	h.reason = reason
+}
+
+func TestMiddlewareSetStatusCode(t *testing.T) {
+	tests := []struct {
+		name            string
+		statusCode      uint32
+		reason          string
+		wantReason      string
+		wantStatusError bool
+		wantError       string
+	}{
+		{
+			name:       "ok",
+			statusCode: 418,
+		},
+		{
+			name:       "reason phrase",
+			statusCode: 299,
+			reason:     "Almost\tOK",
+			wantReason: "Almost\tOK",
+		},
+		{
+			name:            "too low",
+			statusCode:      99,
+			wantStatusError: true,
+		},
+		{
+			name:            "too high",
+			statusCode:      1000,
+			wantStatusError: true,
+		},
+		{
+			name:       "invalid reason phrase",
+			statusCode: 200,
+			reason:     "OK\r\nX-Injected: 1",
+			wantError:  `invalid reason phrase: "OK\r\nX-Injected: 1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			config := binary.LittleEndian.AppendUint32(nil, tc.statusCode)
+			config = append(config, tc.reason...)
+			host := &reasonPhraseHost{}
+			mw, err := NewMiddleware(testCtx, test.BinE2EStatusCode, host, GuestConfig(config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			_, _, err = mw.HandleRequest(testCtx)
+			var statusErr *handler.StatusCodeError
+			switch {
+			case tc.wantStatusError:
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tc.statusCode {
+					t.Fatalf("expected StatusCodeError, have %v", err)
+				}
+				return
+			case tc.wantError != "":
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("expected error %q, have %v", tc.wantError, err)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if want, have := tc.statusCode, host.statusCode; want != have {
+				t.Errorf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if want, have := tc.wantReason, host.reason; want != have {
+				t.Errorf("unexpected reason phrase, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSendResponse_Error(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          byte
+		expectedError string
+	}{
+		{
+			name:          "changed after",
+			mode:          1,
+			expectedError: "can't set status code after send_response",
+		},
+		{
+			name:          "next after",
+			mode:          3,
+			expectedError: "can't call next handler after send_response",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := NewMiddleware(testCtx, test.BinE2ESendResponse, handler.UnimplementedHost{},
+				GuestConfig([]byte{tc.mode}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			_, ctxNext, err := mw.HandleRequest(testCtx)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Fatalf("expected error %q, have %v", tc.expectedError, err)
+			}
+			if ctxNext != 0 {
+				t.Fatalf("expected not to call next, have ctxNext %d", ctxNext)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSendGRPCStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          uint32
+		expectedError string
+	}{
+		{name: "OK", code: 0},
+		{name: "UNAUTHENTICATED", code: 16},
+		{name: "invalid", code: 17, expectedError: "invalid gRPC status code: 17"},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := NewMiddleware(testCtx, test.BinE2EGRPCStatus, handler.UnimplementedHost{},
+				GuestConfig(binary.LittleEndian.AppendUint32(nil, tc.code)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			_, _, err = mw.HandleRequest(testCtx)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Fatalf("expected error %q, have %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestMiddlewareReplaceBody_Error(t *testing.T) {
+	tests := []struct {
+		name          string
+		flags         handler.ReplaceFlags
+		pattern       string
+		expectedError string
+	}{
+		{
+			name:          "unsupported flags",
+			flags:         2,
+			pattern:       "a",
+			expectedError: "unsupported replace flags: 2",
+		},
+		{
+			name:          "empty pattern",
+			expectedError: "pattern cannot be empty",
+		},
+		{
+			name:          "invalid regexp",
+			flags:         handler.ReplaceFlagRegexp,
+			pattern:       "(",
+			expectedError: "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			guestConfig := append([]byte{byte(handler.BodyKindRequest), byte(tc.flags), byte(len(tc.pattern))}, tc.pattern...)
+			mw, err := NewMiddleware(testCtx, test.BinE2EReplaceBody, handler.UnimplementedHost{},
+				GuestConfig(guestConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			_, _, err = mw.HandleRequest(testCtx)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Fatalf("expected error %q, have %v", tc.expectedError, err)
+			}
+		})
+	}
+}
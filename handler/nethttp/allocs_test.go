@@ -0,0 +1,25 @@
+//go:build !race
+
+package wasm_test
+
+import "testing"
+
+// TestRequestAllocs ensures requests don't exceed requestAllocBudget. This
+// doesn't run with the race detector, which allocates when synchronizing.
+func TestRequestAllocs(t *testing.T) {
+	for _, n := range allocBenches {
+		s := benches[n]
+		t.Run(n, func(t *testing.T) {
+			h, closer := newAllocHandler(t, s.bin)
+			defer closer()
+			req := s.request("http://localhost")
+
+			allocs := testing.AllocsPerRun(100, func() {
+				h.ServeHTTP(fakeResponseWriter{}, req)
+			})
+			if allocs > requestAllocBudget {
+				t.Errorf("expected at most %d allocations per request, have %v", requestAllocBudget, allocs)
+			}
+		})
+	}
+}
@@ -47,6 +47,18 @@ func getWithQuery(url string) (req *http.Request) {
 	return
 }
 
+func getWithHeaders(url string) (req *http.Request) {
+	req, _ = http.NewRequest(http.MethodGet, url+"/v1.0/hi", nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Add("Accept", "*/*")
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	req.Header.Set("Accept-Language", "en-US")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Cookie", "a=b; c=d")
+	req.Header.Set("User-Agent", "benchmark")
+	return
+}
+
 func getWithoutHeaders(url string) (req *http.Request) {
 	req, _ = http.NewRequest(http.MethodGet, url+"/v1.0/hi", nil)
 	req.Header = http.Header{}
@@ -141,6 +153,22 @@ var benches = map[string]struct {
 		bin:     test.BinBenchGetHeaderValues,
 		request: getWithoutHeaders,
 	},
+	"get_header_names and values": {
+		bin:     test.BinBenchGetHeaderNamesValues,
+		request: getWithHeaders,
+	},
+	"get_headers none": {
+		bin:     test.BinBenchGetHeaders,
+		request: getWithoutHeaders,
+	},
+	"get_headers": {
+		bin:     test.BinBenchGetHeaders,
+		request: getWithHeaders,
+	},
+	"get_headers large": {
+		bin:     test.BinBenchGetHeaders,
+		request: getWithLargeHeader,
+	},
 	"set_header_value": {
 		bin:     test.BinBenchSetHeaderValue,
 		request: get,
@@ -149,6 +177,10 @@ var benches = map[string]struct {
 		bin:     test.BinBenchAddHeaderValue,
 		request: get,
 	},
+	"set_headers": {
+		bin:     test.BinBenchSetHeaders,
+		request: get,
+	},
 	"remove_header": {
 		bin:     test.BinBenchRemoveHeader,
 		request: get,
@@ -157,6 +189,14 @@ var benches = map[string]struct {
 		bin:     test.BinBenchReadBody,
 		request: post,
 	},
+	"read_body_buffered": {
+		bin:     test.BinBenchReadBodyBuffered,
+		request: post,
+	},
+	"read_body_buffered large": {
+		bin:     test.BinBenchReadBodyBuffered,
+		request: postLarge,
+	},
 	"read_body_stream": {
 		bin:     test.BinBenchReadBodyStream,
 		request: post,
@@ -207,6 +247,43 @@ func benchmark(b *testing.B, name string, bin []byte, handler http.Handler, newR
 	})
 }
 
+// requestAllocBudget is the most allocations the host makes per request,
+// when the guest only calls host functions that return existing values. This
+// excludes allocations of the guest, as they are in wasm memory, and of the
+// next handler.
+const requestAllocBudget = 0
+
+// allocBenches are the benches within requestAllocBudget.
+var allocBenches = []string{"log", "get_uri", "get_header_names", "set_status_code"}
+
+// BenchmarkRequestAllocs reports allocations per request, which should be
+// within requestAllocBudget.
+func BenchmarkRequestAllocs(b *testing.B) {
+	for _, n := range allocBenches {
+		s := benches[n]
+		b.Run(n, func(b *testing.B) {
+			h, closer := newAllocHandler(b, s.bin)
+			defer closer()
+			req := s.request("http://localhost")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(fakeResponseWriter{}, req)
+			}
+		})
+	}
+}
+
+func newAllocHandler(tb testing.TB, bin []byte) (http.Handler, func()) {
+	ctx := context.Background()
+	mw, err := nethttp.NewMiddleware(ctx, bin)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return mw.NewHandler(ctx, noopHandler), func() { mw.Close(ctx) }
+}
+
 var _ http.ResponseWriter = fakeResponseWriter{}
 
 type fakeResponseWriter struct{}
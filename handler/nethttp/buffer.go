@@ -1,25 +1,98 @@
 package wasm
 
 import (
-	"bytes"
+	"bufio"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
+
+	handlerapi "github.com/httpwasm/http-wasm-host-go/api/handler"
+	"github.com/httpwasm/http-wasm-host-go/handler"
 )
 
 type bufferingRequestBody struct {
 	delegate io.ReadCloser
-	buffer   bytes.Buffer
+	buffer   spillBuffer
+
+	// limit is the maximum bytes to buffer, or zero for unlimited.
+	limit int64
+	// length is the declared length of the body, or -1 if unknown.
+	length int64
+	// read is the count of bytes read from the delegate.
+	read int64
+	// eof is true when the delegate was read to the end.
+	eof bool
 }
 
 // Read buffers anything read from the delegate.
 func (b *bufferingRequestBody) Read(p []byte) (n int, err error) {
 	n, err = b.delegate.Read(p)
-	if err != nil && n > 0 {
-		b.buffer.Write(p[0:n])
+	if b.read += int64(n); b.limit > 0 && b.read > b.limit {
+		return 0, &handlerapi.BufferLimitError{Kind: handlerapi.BodyKindRequest, Limit: b.limit}
+	}
+	if n > 0 { // tee every byte read, so that it can be replayed.
+		if _, writeErr := b.buffer.Write(p[0:n]); writeErr != nil {
+			return 0, writeErr
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
 	}
 	return
 }
 
+// readAll buffers the rest of the delegate, returning the bytes not yet read
+// and true, or false if they can't be held in memory.
+//
+// This only reads ahead when the declared length fits within an explicit
+// limit or spill threshold, as the guest may not read the whole body.
+// Otherwise, reading ahead could hold an arbitrarily large body in memory, or
+// fail a request the guest would have let through.
+func (b *bufferingRequestBody) readAll() ([]byte, bool) {
+	if b.eof {
+		return nil, true
+	} else if b.buffer.file != nil || b.length < 0 {
+		return nil, false
+	}
+	bound := b.limit // zero without one, so only an empty body is read.
+	if t := b.buffer.threshold; t > 0 && (bound == 0 || t < bound) {
+		bound = t
+	}
+	if b.length > bound {
+		return nil, false
+	}
+	pos := len(b.buffer.mem)
+	// Errors such as exceeding the limit recur when read as a stream.
+	if _, err := io.Copy(io.Discard, b); err != nil {
+		return nil, false
+	}
+	return b.buffer.mem[pos:], true
+}
+
+// replay returns a body of what was read followed by what wasn't, so that
+// the next handler sees the original.
+func (b *bufferingRequestBody) replay() io.ReadCloser {
+	if b.buffer.Len() == 0 {
+		return b.delegate
+	} else if b.eof {
+		b.Close() // nolint: the delegate has nothing left to read.
+		return io.NopCloser(b.buffer.Reader())
+	}
+	return &replayBody{
+		Reader: io.MultiReader(b.buffer.Reader(), b.delegate),
+		Closer: b.delegate,
+	}
+}
+
+// replayBody reads buffered bytes and then the rest of the delegate, which it
+// closes.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
 // Close dispatches to the delegate.
 func (b *bufferingRequestBody) Close() (err error) {
 	if b.delegate != nil {
@@ -31,7 +104,29 @@ func (b *bufferingRequestBody) Close() (err error) {
 type bufferingResponseWriter struct {
 	delegate   http.ResponseWriter
 	statusCode uint32
-	body       []byte
+	body       spillBuffer
+
+	// limit is the maximum bytes to buffer, or zero for unlimited.
+	limit int64
+	// err is a handlerapi.BufferLimitError once the body exceeded the limit.
+	err error
+
+	// rewritten is true when the guest overwrote the body, so headers need
+	// to be reconciled with it per policy.
+	rewritten bool
+	policy    handler.RewritePolicy
+
+	// decoded is true when the guest overwrote the body with decoded
+	// content, so it needs to be encoded per "Content-Encoding".
+	decoded bool
+
+	// replaced are bodies the guest overwrote, retained until Close as the
+	// guest may still be reading them.
+	replaced []spillBuffer
+
+	// request is the request being responded to, which determines if the
+	// response can have trailers.
+	request *http.Request
 }
 
 // Header dispatches to the delegate.
@@ -39,24 +134,127 @@ func (w *bufferingResponseWriter) Header() http.Header {
 	return w.delegate.Header()
 }
 
-// Write buffers the response body.
+// Write buffers the response body, unless that would exceed the limit.
 func (w *bufferingResponseWriter) Write(bytes []byte) (int, error) {
-	w.body = append(w.body, bytes...)
-	return len(bytes), nil
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.limit > 0 && w.body.Len()+int64(len(bytes)) > w.limit {
+		_ = w.body.Reset() // discard what can't be sent whole
+		w.err = &handlerapi.BufferLimitError{Kind: handlerapi.BodyKindResponse, Limit: w.limit}
+		return 0, w.err
+	}
+	return w.body.Write(bytes)
 }
 
-// WriteHeader buffers the status code.
+// WriteHeader buffers the status code. Informational responses, such as 103
+// Early Hints, are sent immediately as they precede the buffered one.
 func (w *bufferingResponseWriter) WriteHeader(statusCode int) {
+	if isInformational(statusCode) {
+		w.delegate.WriteHeader(statusCode)
+		return
+	}
 	w.statusCode = uint32(statusCode)
 }
 
-// release sends any response data collected.
+// FlushError returns an error, as the response is sent once the guest
+// handled it. This intentionally doesn't implement http.Flusher, so that
+// handlers such as server-sent events can tell flushing isn't supported.
+func (w *bufferingResponseWriter) FlushError() error {
+	return fmt.Errorf("can't flush a buffered response: %w", http.ErrNotSupported)
+}
+
+// Hijack returns an error, as the guest couldn't handle the response of a
+// hijacked connection.
+func (w *bufferingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("can't hijack a buffered response: %w", http.ErrNotSupported)
+}
+
+// Unwrap returns the delegate, so that http.ResponseController can control
+// it, for example to set deadlines.
+func (w *bufferingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.delegate
+}
+
+// rewrite starts a new body for the guest to write, retaining the current
+// one for any reader of it.
+func (w *bufferingResponseWriter) rewrite() {
+	w.replaced = append(w.replaced, w.body)
+	w.body = spillBuffer{threshold: w.body.threshold, dir: w.body.dir}
+}
+
+// Close discards the body and any it replaced, removing temporary files.
+func (w *bufferingResponseWriter) Close() (err error) {
+	err = w.body.Reset()
+	for i := range w.replaced {
+		if resetErr := w.replaced[i].Reset(); err == nil {
+			err = resetErr
+		}
+	}
+	w.replaced = nil
+	return
+}
+
+// release sends any response data collected, or an error if the body
+// exceeded the limit and wasn't overwritten.
 func (w *bufferingResponseWriter) release() {
+	if w.err != nil {
+		handleErr(w.delegate, http.StatusInternalServerError, w.err)
+		return
+	}
+	if w.decoded {
+		if err := w.encodeBody(); err != nil {
+			handleErr(w.delegate, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if w.rewritten {
+		fixHeaders(w.delegate.Header(), w.policy, w.body.Len())
+	}
+	if w.request != nil {
+		statusCode := w.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		announceTrailers(w.request, statusCode, w.delegate.Header())
+	}
 	// If we deferred the response, release it.
 	if statusCode := w.statusCode; statusCode != 0 {
 		w.delegate.WriteHeader(int(statusCode))
 	}
-	if body := w.body; len(body) != 0 {
-		w.delegate.Write(body) // nolint
+	if w.body.Len() != 0 {
+		io.Copy(w.delegate, w.body.Reader()) // nolint
+	}
+}
+
+// encodeBody replaces the body with its encoding per "Content-Encoding".
+func (w *bufferingResponseWriter) encodeBody() error {
+	coding := contentCoding(w.delegate.Header())
+	if coding == "" {
+		return nil
+	}
+	encoded := spillBuffer{threshold: w.body.threshold, dir: w.body.dir}
+	if err := encode(coding, &encoded, w.body.Reader()); err != nil {
+		_ = encoded.Reset()
+		return fmt.Errorf("error encoding %s body: %w", coding, err)
+	}
+	_ = w.body.Reset()
+	w.body = encoded
+	return nil
+}
+
+// fixHeaders reconciles headers with a body the guest overwrote, per policy.
+// A negative length means the length of the new body is unknown.
+func fixHeaders(header http.Header, policy handler.RewritePolicy, length int64) {
+	if policy&handler.RewriteContentLength != 0 {
+		if length < 0 {
+			header.Del("Content-Length")
+		} else {
+			header.Set("Content-Length", strconv.FormatInt(length, 10))
+		}
+	}
+	if policy&handler.RewriteRemoveValidators != 0 {
+		header.Del("Content-MD5")
+		header.Del("ETag")
 	}
 }
@@ -11,3 +11,7 @@ var _ io.ReadCloser = &bufferingRequestBody{}
 // compile-time check to ensure bufferingResponseWriter implements
 // http.ResponseWriter.
 var _ http.ResponseWriter = &bufferingResponseWriter{}
+
+// compile-time check to ensure bufferingResponseWriter fails hijacking
+// instead of http.ResponseController unwrapping it.
+var _ http.Hijacker = &bufferingResponseWriter{}
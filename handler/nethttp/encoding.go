@@ -0,0 +1,80 @@
+package wasm
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// contentCoding returns the coding of a body with the given headers, if
+// handler.FeatureDecodeContent supports it, or empty if it should be left
+// as-is.
+func contentCoding(header http.Header) string {
+	values := header.Values("Content-Encoding")
+	if len(values) != 1 {
+		return ""
+	}
+	switch coding := strings.ToLower(strings.TrimSpace(values[0])); coding {
+	case "gzip", "x-gzip":
+		return "gzip"
+	case "deflate":
+		return coding
+	}
+	return ""
+}
+
+// decodingReader returns a reader of the content of a body in the given
+// coding. Closing it closes the body.
+func decodingReader(coding string, body io.ReadCloser) io.ReadCloser {
+	var decoder io.ReadCloser
+	var err error
+	switch coding {
+	case "gzip":
+		decoder, err = gzip.NewReader(body)
+	case "deflate": // HTTP "deflate" is the zlib format, per RFC 9110.
+		decoder, err = zlib.NewReader(body)
+	default:
+		return body
+	}
+
+	if err == io.EOF { // empty body
+		return body
+	} else if err != nil {
+		panic(fmt.Errorf("error decoding %s body: %w", coding, err))
+	}
+	return &decodedBody{Reader: decoder, decoder: decoder, body: body}
+}
+
+// decodedBody reads content from a decoder of an encoded body.
+type decodedBody struct {
+	io.Reader
+	decoder, body io.Closer
+}
+
+// Close closes the decoder and then the body.
+func (b *decodedBody) Close() error {
+	_ = b.decoder.Close() // doesn't close the body.
+	return b.body.Close()
+}
+
+// encode writes the content read from r to w, in the given coding.
+func encode(coding string, w io.Writer, r io.Reader) error {
+	var encoder io.WriteCloser
+	switch coding {
+	case "gzip":
+		encoder = gzip.NewWriter(w)
+	case "deflate":
+		encoder = zlib.NewWriter(w)
+	default:
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	if _, err := io.Copy(encoder, r); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,191 @@
+//go:build go1.24
+
+package wasm_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/httpwasm/http-wasm-host-go/handler"
+	wasm "github.com/httpwasm/http-wasm-host-go/handler/nethttp"
+	"github.com/httpwasm/http-wasm-host-go/internal/test"
+)
+
+// grpcFrame returns the gRPC messages, each with its length prefix.
+func grpcFrame(messages ...string) []byte {
+	var b bytes.Buffer
+	for _, m := range messages {
+		prefix := [5]byte{}
+		binary.BigEndian.PutUint32(prefix[1:], uint32(len(m)))
+		b.Write(prefix[:])
+		b.WriteString(m)
+	}
+	return b.Bytes()
+}
+
+// TestGRPC ensures a guest can inspect gRPC messages and trailers, and deny
+// requests with a gRPC status, over HTTP/2 without TLS (h2c).
+func TestGRPC(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EGRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	// next responds like grpc-go, which declares trailers before writing the
+	// response, and sets them afterwards.
+	var nextCalled atomic.Bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled.Store(true)
+		// This runs on the server goroutine, where t.Fatal can't stop the test.
+		if _, err := io.ReadAll(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		w.Write(grpcFrame("pong")) // nolint
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "")
+	})
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+
+	ts := httptest.NewUnstartedServer(mw.NewHandler(testCtx, next))
+	ts.Config.Protocols = &protocols
+	ts.Start()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+
+	tests := []struct {
+		name           string
+		body           []byte
+		wantNextCalled bool
+		wantBody       []byte
+		wantStatus     string // header in a Trailers-Only response
+		wantMessage    string
+		wantTrailer    http.Header
+	}{
+		{
+			name:           "allowed",
+			body:           grpcFrame("ping"),
+			wantNextCalled: true,
+			wantBody:       grpcFrame("pong"),
+			wantTrailer: http.Header{
+				"Grpc-Status":         {"0"},
+				"Grpc-Message":        {""},
+				"X-Seen-Grpc-Status":  {"0"},
+				"X-Response-Messages": {"1"},
+			},
+		},
+		{
+			name:        "denied",
+			body:        grpcFrame("deny", "ping"),
+			wantStatus:  "7",
+			wantMessage: "denied: 100%25",
+		},
+		{
+			name:        "no messages",
+			wantStatus:  "3",
+			wantMessage: "no messages",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			nextCalled.Store(false)
+
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+"/helloworld.Greeter/SayHello", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/grpc")
+			req.Header.Set("Te", "trailers")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, have := "HTTP/2.0", resp.Proto; want != have {
+				t.Fatalf("unexpected protocol, want: %q, have: %q", want, have)
+			}
+			if want, have := http.StatusOK, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if want, have := tc.wantNextCalled, nextCalled.Load(); want != have {
+				t.Fatalf("unexpected next called, want: %v, have: %v", want, have)
+			}
+			if want, have := tc.wantBody, body; !bytes.Equal(want, have) {
+				t.Fatalf("unexpected body, want: %q, have: %q", want, have)
+			}
+			if want, have := tc.wantStatus, resp.Header.Get("Grpc-Status"); want != have {
+				t.Fatalf("unexpected Grpc-Status header, want: %q, have: %q", want, have)
+			}
+			if want, have := tc.wantMessage, resp.Header.Get("Grpc-Message"); want != have {
+				t.Fatalf("unexpected Grpc-Message header, want: %q, have: %q", want, have)
+			}
+			for k := range tc.wantTrailer {
+				if want, have := tc.wantTrailer.Get(k), resp.Trailer.Get(k); want != have {
+					t.Fatalf("unexpected %s trailer, want: %q, have: %q", k, want, have)
+				}
+			}
+		})
+	}
+}
+
+// TestGRPC_RequestLimit ensures a gRPC request body larger than the host
+// parses fails with the gRPC status RESOURCE_EXHAUSTED.
+func TestGRPC_RequestLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []handler.Option
+	}{
+		{name: "MaxFormSize", options: []handler.Option{handler.MaxFormSize(8)}},
+		{name: "MaxRequestBuffer", options: []handler.Option{handler.MaxRequestBuffer(8)}},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EGRPC, tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { t.Error("next handler called") })
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+"/helloworld.Greeter/SayHello", bytes.NewReader(grpcFrame("ping")))
+			req.Header.Set("Content-Type", "application/grpc")
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := http.StatusOK, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if want, have := "8", resp.Header.Get("Grpc-Status"); want != have {
+				t.Fatalf("unexpected Grpc-Status header, want: %q, have: %q", want, have)
+			}
+			if want, have := "request body exceeds buffer limit of 8 bytes", resp.Header.Get("Grpc-Message"); want != have {
+				t.Fatalf("unexpected Grpc-Message header, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
@@ -3,7 +3,12 @@ package wasm
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
@@ -15,12 +20,17 @@ import (
 
 type host struct{}
 
-var _ handler.Host = host{}
+var (
+	_ handler.Host              = host{}
+	_ handler.InformationalHost = host{}
+	_ handler.ResponseSentHost  = host{}
+	_ handler.BodyBytesHost     = host{}
+)
 
 // EnableFeatures implements the same method as documented on handler.Host.
 func (host) EnableFeatures(ctx context.Context, features handler.Features) handler.Features {
 	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
-		s.enableFeatures(features)
+		return s.enableFeatures(features)
 	}
 	// Otherwise, this was called during init, but there's nothing to do
 	// because net/http supports all features.
@@ -51,7 +61,11 @@ func (host) SetTemplate(ctx context.Context, method string) {
 // GetURI implements the same method as documented on handler.Host.
 func (host) GetURI(ctx context.Context) string {
 	r := requestStateFromContext(ctx).r
-	u := r.URL
+	return requestURI(r.URL)
+}
+
+// requestURI returns the path and query of the URL.
+func requestURI(u *url.URL) string {
 	result := u.EscapedPath()
 	if result == "" {
 		result = "/"
@@ -84,50 +98,129 @@ func (host) SetURI(ctx context.Context, uri string) {
 	r.URL.RawQuery = u.RawQuery
 }
 
-// GetProtocolVersion implements the same method as documented on handler.Host.
-func (host) GetProtocolVersion(ctx context.Context) string {
+// GetQueryNames implements the same method as documented on handler.Host.
+func (host) GetQueryNames(ctx context.Context) (names []string) {
 	r := requestStateFromContext(ctx).r
-	return r.Proto
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return nil
+	}
+
+	names = make([]string, 0, len(query))
+	for n := range query {
+		names = append(names, n)
+	}
+
+	// Keys in a Go map don't have consistent ordering.
+	sort.Strings(names)
+	return
 }
 
-// GetRequestHeaderNames implements the same method as documented on handler.Host.
-func (host) GetRequestHeaderNames(ctx context.Context) (names []string) {
+// GetQueryValues implements the same method as documented on handler.Host.
+func (host) GetQueryValues(ctx context.Context, name string) []string {
+	r := requestStateFromContext(ctx).r
+	return r.URL.Query()[name]
+}
+
+// SetQueryValue implements the same method as documented on handler.Host.
+func (host) SetQueryValue(ctx context.Context, name, value string) {
 	r := requestStateFromContext(ctx).r
+	query := r.URL.Query()
+	query.Set(name, value)
+	setQuery(r, query)
+}
 
-	count := len(r.Header)
-	i := 0
-	if r.Host != "" { // special-case the host header.
-		count++
-		names = make([]string, count)
-		names[i] = "Host"
-		i++
-	} else if count == 0 {
-		return nil
-	} else {
-		names = make([]string, count)
+// AddQueryValue implements the same method as documented on handler.Host.
+func (host) AddQueryValue(ctx context.Context, name, value string) {
+	r := requestStateFromContext(ctx).r
+	query := r.URL.Query()
+	query.Add(name, value)
+	setQuery(r, query)
+}
+
+// RemoveQuery implements the same method as documented on handler.Host.
+func (host) RemoveQuery(ctx context.Context, name string) {
+	r := requestStateFromContext(ctx).r
+	query := r.URL.Query()
+	if _, ok := query[name]; !ok {
+		return // don't re-encode the query when nothing changed.
 	}
+	query.Del(name)
+	setQuery(r, query)
+}
 
-	for n := range r.Header {
-		if strings.HasPrefix(n, http.TrailerPrefix) {
-			continue
-		}
-		names[i] = n
-		i++
+// setQuery re-encodes the query of the request URI.
+//
+// Note: url.Values.Encode sorts parameters by name, and the values of each
+// parameter retain their order.
+func setQuery(r *http.Request, query url.Values) {
+	r.URL.RawQuery = query.Encode()
+	r.URL.ForceQuery = false
+	r.RequestURI = requestURI(r.URL)
+}
+
+// GetScheme implements the same method as documented on handler.Host.
+func (host) GetScheme(ctx context.Context) string {
+	r := requestStateFromContext(ctx).r
+	if r.URL.Scheme != "" { // absolute-form or overwritten
+		return r.URL.Scheme
+	} else if r.TLS != nil {
+		return "https"
 	}
+	return "http"
+}
 
-	if len(names) == 0 { // E.g. only trailers
-		return nil
+// SetScheme implements the same method as documented on handler.Host.
+//
+// Note: Only "http" and "https" are valid, as net/http serves no others.
+func (host) SetScheme(ctx context.Context, scheme string) {
+	r := requestStateFromContext(ctx).r
+	switch s := strings.ToLower(scheme); s {
+	case "http", "https":
+		r.URL.Scheme = s
+	default:
+		panic(fmt.Errorf("invalid scheme: %q", scheme))
 	}
+}
 
-	// Keys in a Go map don't have consistent ordering.
-	sort.Strings(names)
-	return
+// GetAuthority implements the same method as documented on handler.Host.
+func (host) GetAuthority(ctx context.Context) string {
+	r := requestStateFromContext(ctx).r
+	// net/http uses Request.Host for both the HTTP/1.1 "Host" header and the
+	// HTTP/2 ":authority" pseudo-header.
+	return r.Host
+}
+
+// SetAuthority implements the same method as documented on handler.Host.
+func (host) SetAuthority(ctx context.Context, authority string) {
+	r := requestStateFromContext(ctx).r
+	setHost(r, authority)
+}
+
+// GetProtocolVersion implements the same method as documented on handler.Host.
+func (host) GetProtocolVersion(ctx context.Context) string {
+	r := requestStateFromContext(ctx).r
+	return r.Proto
+}
+
+// GetRequestHeaderNames implements the same method as documented on handler.Host.
+func (host) GetRequestHeaderNames(ctx context.Context) (names []string) {
+	s := requestStateFromContext(ctx)
+
+	var extra string
+	if s.r.Host != "" { // special-case the host header.
+		extra = "Host"
+	}
+	return s.requestHeaderNames.get(s.r.Header, extra)
 }
 
 // GetRequestHeaderValues implements the same method as documented on handler.Host.
 func (host) GetRequestHeaderValues(ctx context.Context, name string) []string {
 	r := requestStateFromContext(ctx).r
-	if textproto.CanonicalMIMEHeaderKey(name) == "Host" { // special-case the host header.
+	if isHostHeader(name) { // special-case the host header.
+		if r.Host == "" {
+			return nil
+		}
 		return []string{r.Host}
 	}
 	return r.Header.Values(name)
@@ -136,115 +229,201 @@ func (host) GetRequestHeaderValues(ctx context.Context, name string) []string {
 // SetRequestHeaderValue implements the same method as documented on handler.Host.
 func (host) SetRequestHeaderValue(ctx context.Context, name, value string) {
 	s := requestStateFromContext(ctx)
+	if isHostHeader(name) { // special-case the host header.
+		setHost(s.r, value)
+		return
+	}
 	s.r.Header.Set(name, value)
 }
 
 // AddRequestHeaderValue implements the same method as documented on handler.Host.
 func (host) AddRequestHeaderValue(ctx context.Context, name, value string) {
 	s := requestStateFromContext(ctx)
+	if isHostHeader(name) { // special-case the host header.
+		// The host header cannot have multiple values, so add is set.
+		setHost(s.r, value)
+		return
+	}
 	s.r.Header.Add(name, value)
 }
 
 // RemoveRequestHeader implements the same method as documented on handler.Host.
 func (host) RemoveRequestHeader(ctx context.Context, name string) {
 	s := requestStateFromContext(ctx)
+	if isHostHeader(name) { // special-case the host header.
+		setHost(s.r, "")
+		return
+	}
 	s.r.Header.Del(name)
 }
 
+// isHostHeader returns true if the name is the "Host" request header, which
+// net/http removes from Request.Header in favor of Request.Host.
+func isHostHeader(name string) bool {
+	return textproto.CanonicalMIMEHeaderKey(name) == "Host"
+}
+
+// setHost changes the authority of the request, keeping the URL consistent
+// when the request was received in absolute-form.
+func setHost(r *http.Request, host string) {
+	r.Host = host
+	if r.URL.Host != "" {
+		r.URL.Host = host
+	}
+}
+
 // RequestBodyReader implements the same method as documented on handler.Host.
 func (host) RequestBodyReader(ctx context.Context) io.ReadCloser {
 	s := requestStateFromContext(ctx)
-	return s.r.Body
+	var body io.ReadCloser
+	switch b := s.r.Body.(type) {
+	case *streamingRequestBody:
+		return io.NopCloser(bytes.NewReader(b.chunk))
+	case *bufferingRequestBody:
+		// Don't let the guest close it, as the next handler reads any rest.
+		body = io.NopCloser(b)
+	default:
+		body = s.r.Body
+	}
+	if s.features.IsEnabled(handler.FeatureDecodeContent) {
+		body = decodingReader(contentCoding(s.r.Header), body)
+	}
+	return body
+}
+
+// RequestBodyBytes implements the same method as documented on
+// handler.BodyBytesHost.
+func (host) RequestBodyBytes(ctx context.Context) ([]byte, bool) {
+	s := requestStateFromContext(ctx)
+	switch b := s.r.Body.(type) {
+	case *streamingRequestBody:
+		return b.chunk, true
+	case *bufferingRequestBody:
+		if s.features.IsEnabled(handler.FeatureDecodeContent) && contentCoding(s.r.Header) != "" {
+			return nil, false // the guest reads decoded content.
+		}
+		return b.readAll()
+	default:
+		return nil, false
+	}
 }
 
 // RequestBodyWriter implements the same method as documented on handler.Host.
 func (host) RequestBodyWriter(ctx context.Context) io.Writer {
 	s := requestStateFromContext(ctx)
+	if b, ok := s.r.Body.(*streamingRequestBody); ok {
+		return b.bodyWriter()
+	}
+	if s.features.IsEnabled(handler.FeatureDecodeContent) && contentCoding(s.r.Header) != "" {
+		s.r.Header.Del("Content-Encoding") // the guest writes decoded content.
+	}
 	var b bytes.Buffer // reset
 	s.r.Body = io.NopCloser(&b)
+	s.rewrittenRequest = &b
 	return &b
 }
 
 // GetRequestTrailerNames implements the same method as documented on
 // handler.Host.
 func (host) GetRequestTrailerNames(ctx context.Context) (names []string) {
-	header := requestStateFromContext(ctx).w.Header()
-	return trailerNames(header)
+	r := requestStateFromContext(ctx).r
+	// r.Trailer includes names announced by the "Trailer" header, which have
+	// no values until the body is read to EOF.
+	for n, vs := range r.Trailer {
+		if len(vs) > 0 {
+			names = append(names, n)
+		}
+	}
+	// Keys in a Go map don't have consistent ordering.
+	sort.Strings(names)
+	return
 }
 
 // GetRequestTrailerValues implements the same method as documented on
 // handler.Host.
 func (host) GetRequestTrailerValues(ctx context.Context, name string) []string {
-	header := requestStateFromContext(ctx).w.Header()
-	return getTrailers(header, name)
+	r := requestStateFromContext(ctx).r
+	return r.Trailer.Values(name)
 }
 
 // SetRequestTrailerValue implements the same method as documented on
 // handler.Host.
 func (host) SetRequestTrailerValue(ctx context.Context, name, value string) {
-	header := requestStateFromContext(ctx).w.Header()
-	setTrailer(header, name, value)
+	r := requestStateFromContext(ctx).r
+	if r.Trailer == nil {
+		r.Trailer = http.Header{}
+	}
+	r.Trailer.Set(name, value)
 }
 
 // AddRequestTrailerValue implements the same method as documented on
 // handler.Host.
 func (host) AddRequestTrailerValue(ctx context.Context, name, value string) {
-	header := requestStateFromContext(ctx).w.Header()
-	addTrailer(header, name, value)
+	r := requestStateFromContext(ctx).r
+	if r.Trailer == nil {
+		r.Trailer = http.Header{}
+	}
+	r.Trailer.Add(name, value)
 }
 
 // RemoveRequestTrailer implements the same method as documented on handler.Host.
 func (host) RemoveRequestTrailer(ctx context.Context, name string) {
-	header := requestStateFromContext(ctx).w.Header()
-	removeTrailer(header, name)
+	r := requestStateFromContext(ctx).r
+	r.Trailer.Del(name)
 }
 
 // GetStatusCode implements the same method as documented on handler.Host.
 func (host) GetStatusCode(ctx context.Context) uint32 {
 	s := requestStateFromContext(ctx)
-	if statusCode := s.w.(*bufferingResponseWriter).statusCode; statusCode == 0 {
-		return 200 // default
-	} else {
-		return statusCode
+	var statusCode uint32
+	switch w := s.w.(type) {
+	case *bufferingResponseWriter:
+		statusCode = w.statusCode
+	case *streamingResponseWriter:
+		statusCode = w.statusCode
 	}
+	if statusCode == 0 {
+		statusCode = s.recorder.statusCode
+	}
+	if statusCode == 0 {
+		return http.StatusOK // default
+	}
+	return statusCode
 }
 
 // SetStatusCode implements the same method as documented on handler.Host.
 func (host) SetStatusCode(ctx context.Context, statusCode uint32) {
 	s := requestStateFromContext(ctx)
-	if w, ok := s.w.(*bufferingResponseWriter); ok {
+	switch w := s.w.(type) {
+	case *bufferingResponseWriter:
+		w.statusCode = statusCode
+	case *streamingResponseWriter:
 		w.statusCode = statusCode
-	} else {
+	default:
 		s.w.WriteHeader(int(statusCode))
 	}
 }
 
+// SendInformational implements the same method as documented on
+// handler.InformationalHost.
+func (host) SendInformational(ctx context.Context, statusCode uint32) {
+	// Bypass wrappers which defer the final status code. net/http sends the
+	// current headers with any 1xx status code.
+	requestStateFromContext(ctx).recorder.WriteHeader(int(statusCode))
+}
+
+// ResponseHeadersSent implements the same method as documented on
+// handler.ResponseSentHost.
+func (host) ResponseHeadersSent(ctx context.Context) bool {
+	// The recorder is the innermost writer, so only sees what was sent.
+	return requestStateFromContext(ctx).recorder.statusCode != 0
+}
+
 // GetResponseHeaderNames implements the same method as documented on
 // handler.Host.
 func (host) GetResponseHeaderNames(ctx context.Context) (names []string) {
-	w := requestStateFromContext(ctx).w
-
-	// allocate capacity == count though it might be smaller due to trailers.
-	count := len(w.Header())
-	if count == 0 {
-		return nil
-	}
-
-	names = make([]string, 0, count)
-
-	for n := range w.Header() {
-		if strings.HasPrefix(n, http.TrailerPrefix) {
-			continue
-		}
-		names = append(names, n)
-	}
-
-	if len(names) == 0 { // E.g. only trailers
-		return nil
-	}
-	// Keys in a Go map don't have consistent ordering.
-	sort.Strings(names)
-	return
+	s := requestStateFromContext(ctx)
+	return s.responseHeaderNames.get(s.w.Header(), "")
 }
 
 // GetResponseHeaderValues implements the same method as documented on
@@ -278,17 +457,52 @@ func (host) RemoveResponseHeader(ctx context.Context, name string) {
 // ResponseBodyReader implements the same method as documented on handler.Host.
 func (host) ResponseBodyReader(ctx context.Context) io.ReadCloser {
 	s := requestStateFromContext(ctx)
-	body := s.w.(*bufferingResponseWriter).body
-	return io.NopCloser(bytes.NewReader(body))
+	switch w := s.w.(type) {
+	case *bufferingResponseWriter:
+		body := io.NopCloser(w.body.Reader())
+		if !w.decoded && s.features.IsEnabled(handler.FeatureDecodeContent) {
+			body = decodingReader(contentCoding(w.Header()), body)
+		}
+		return body
+	case *streamingResponseWriter:
+		return io.NopCloser(bytes.NewReader(w.chunk))
+	default:
+		return io.NopCloser(bytes.NewReader(nil))
+	}
+}
+
+// ResponseBodyBytes implements the same method as documented on
+// handler.BodyBytesHost.
+func (host) ResponseBodyBytes(ctx context.Context) ([]byte, bool) {
+	s := requestStateFromContext(ctx)
+	switch w := s.w.(type) {
+	case *bufferingResponseWriter:
+		if w.body.file != nil {
+			return nil, false // spilled to disk
+		} else if !w.decoded && s.features.IsEnabled(handler.FeatureDecodeContent) && contentCoding(w.Header()) != "" {
+			return nil, false // the guest reads decoded content.
+		}
+		// Borrowed: a rewrite starts a new buffer instead of reusing this.
+		return w.body.mem, true
+	case *streamingResponseWriter:
+		return w.chunk, true
+	default:
+		return nil, true
+	}
 }
 
 // ResponseBodyWriter implements the same method as documented on handler.Host.
 func (host) ResponseBodyWriter(ctx context.Context) io.Writer {
 	s := requestStateFromContext(ctx)
-	if w, ok := s.w.(*bufferingResponseWriter); ok {
-		w.body = nil // reset
+	switch w := s.w.(type) {
+	case *bufferingResponseWriter:
+		w.rewrite() // the guest replaces the body
+		w.err, w.rewritten = nil, true
+		w.decoded = s.features.IsEnabled(handler.FeatureDecodeContent)
 		return w
-	} else {
+	case *streamingResponseWriter:
+		return w.bodyWriter()
+	default:
 		return s.w
 	}
 }
@@ -310,21 +524,335 @@ func (host) GetResponseTrailerValues(ctx context.Context, name string) []string
 // SetResponseTrailerValue implements the same method as documented on
 // handler.Host.
 func (host) SetResponseTrailerValue(ctx context.Context, name, value string) {
-	header := requestStateFromContext(ctx).w.Header()
-	setTrailer(header, name, value)
+	s := requestStateFromContext(ctx)
+	mustTrailersSendable(s)
+	setTrailer(s.w.Header(), name, value)
 }
 
 // AddResponseTrailerValue implements the same method as documented on
 // handler.Host.
 func (host) AddResponseTrailerValue(ctx context.Context, name, value string) {
-	header := requestStateFromContext(ctx).w.Header()
-	addTrailer(header, name, value)
+	s := requestStateFromContext(ctx)
+	mustTrailersSendable(s)
+	addTrailer(s.w.Header(), name, value)
 }
 
 // RemoveResponseTrailer implements the same method as documented on handler.Host.
 func (host) RemoveResponseTrailer(ctx context.Context, name string) {
+	s := requestStateFromContext(ctx)
+	mustTrailersSendable(s)
+	removeTrailer(s.w.Header(), name)
+}
+
+// GetRequestCookieNames implements the same method as documented on
+// handler.Host.
+func (host) GetRequestCookieNames(ctx context.Context) (names []string) {
+	r := requestStateFromContext(ctx).r
+	for _, c := range r.Cookies() {
+		if !containsString(names, c.Name) {
+			names = append(names, c.Name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// GetRequestCookieValues implements the same method as documented on
+// handler.Host.
+func (host) GetRequestCookieValues(ctx context.Context, name string) (values []string) {
+	r := requestStateFromContext(ctx).r
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			values = append(values, c.Value)
+		}
+	}
+	return
+}
+
+// SetResponseCookie implements the same method as documented on
+// handler.Host.
+func (host) SetResponseCookie(ctx context.Context, cookie handler.Cookie) {
 	header := requestStateFromContext(ctx).w.Header()
-	removeTrailer(header, name)
+	c := &http.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		MaxAge:   int(cookie.MaxAge),
+		Secure:   cookie.Flags&handler.CookieFlagSecure != 0,
+		HttpOnly: cookie.Flags&handler.CookieFlagHttpOnly != 0,
+	}
+	switch {
+	case cookie.Flags&handler.CookieFlagSameSiteLax != 0:
+		c.SameSite = http.SameSiteLaxMode
+	case cookie.Flags&handler.CookieFlagSameSiteStrict != 0:
+		c.SameSite = http.SameSiteStrictMode
+	case cookie.Flags&handler.CookieFlagSameSiteNone != 0:
+		c.SameSite = http.SameSiteNoneMode
+	}
+	setCookie(header, c)
+}
+
+// DeleteResponseCookie implements the same method as documented on
+// handler.Host.
+func (host) DeleteResponseCookie(ctx context.Context, name, path, domain string) {
+	header := requestStateFromContext(ctx).w.Header()
+	setCookie(header, &http.Cookie{Name: name, Path: path, Domain: domain, MaxAge: -1})
+}
+
+// setCookie adds a "Set-Cookie" header for the cookie, after removing any
+// others with the same name, path and domain.
+func setCookie(header http.Header, c *http.Cookie) {
+	v := c.String()
+	if v == "" {
+		panic(fmt.Errorf("invalid cookie name: %q", c.Name))
+	}
+
+	var values []string
+	for _, existing := range header.Values("Set-Cookie") {
+		if !sameCookie(existing, c) {
+			values = append(values, existing)
+		}
+	}
+	header["Set-Cookie"] = append(values, v)
+}
+
+// sameCookie returns true if the "Set-Cookie" header value is for the same
+// cookie, as identified by its name, path and domain.
+func sameCookie(setCookie string, c *http.Cookie) bool {
+	parsed := (&http.Response{Header: http.Header{"Set-Cookie": {setCookie}}}).Cookies()
+	if len(parsed) != 1 {
+		return false // unparsable cookies are left alone.
+	}
+	existing := parsed[0]
+	return existing.Name == c.Name &&
+		existing.Path == c.Path &&
+		strings.TrimPrefix(existing.Domain, ".") == strings.TrimPrefix(c.Domain, ".")
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRemoteAddr implements the same method as documented on handler.Host.
+func (host) GetRemoteAddr(ctx context.Context) string {
+	r := requestStateFromContext(ctx).r
+	return r.RemoteAddr
+}
+
+// GetLocalAddr implements the same method as documented on handler.Host.
+func (host) GetLocalAddr(ctx context.Context) string {
+	r := requestStateFromContext(ctx).r
+	// http.Server adds the listener address to the request context.
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+// GetTLSVersion implements the same method as documented on handler.Host.
+func (host) GetTLSVersion(ctx context.Context) string {
+	if state := requestStateFromContext(ctx).r.TLS; state != nil {
+		return tlsVersionName(state.Version)
+	}
+	return ""
+}
+
+// GetTLSCipherSuite implements the same method as documented on handler.Host.
+func (host) GetTLSCipherSuite(ctx context.Context) string {
+	if state := requestStateFromContext(ctx).r.TLS; state != nil {
+		return tls.CipherSuiteName(state.CipherSuite)
+	}
+	return ""
+}
+
+// GetTLSServerName implements the same method as documented on handler.Host.
+func (host) GetTLSServerName(ctx context.Context) string {
+	if state := requestStateFromContext(ctx).r.TLS; state != nil {
+		return state.ServerName
+	}
+	return ""
+}
+
+// GetTLSPeerSubject implements the same method as documented on handler.Host.
+func (host) GetTLSPeerSubject(ctx context.Context) string {
+	if cert := peerCertificate(requestStateFromContext(ctx).r); cert != nil {
+		return cert.Subject.String()
+	}
+	return ""
+}
+
+// GetTLSPeerSANs implements the same method as documented on handler.Host.
+func (host) GetTLSPeerSANs(ctx context.Context) (sans []string) {
+	cert := peerCertificate(requestStateFromContext(ctx).r)
+	if cert == nil {
+		return
+	}
+	for _, n := range cert.DNSNames {
+		sans = append(sans, "DNS:"+n)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, e := range cert.EmailAddresses {
+		sans = append(sans, "email:"+e)
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, "URI:"+u.String())
+	}
+	return
+}
+
+// peerCertificate returns the leaf certificate presented by the client or nil
+// if there was none.
+func peerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// tlsVersionName is like tls.VersionName, which isn't available until Go 1.21.
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// mustTrailersSendable panics if the response headers were sent in a way
+// that doesn't allow trailers, so changing them would have no effect.
+func mustTrailersSendable(s *requestState) {
+	if w, ok := s.w.(*streamingResponseWriter); ok && w.sentHeader && !w.trailersSendable {
+		panic(errors.New("can't change response trailers: response headers were sent without chunked encoding"))
+	}
+}
+
+// announceTrailers declares any trailers in the "Trailer" header, before the
+// response headers are sent. It returns false if the response can't have
+// trailers, for example a HTTP/1.1 response without chunked encoding.
+func announceTrailers(r *http.Request, statusCode uint32, header http.Header) bool {
+	if !bodyAllowed(r, statusCode) {
+		return false
+	} else if r.ProtoMajor < 2 {
+		// HTTP/1.x only sends trailers with chunked encoding, which net/http
+		// doesn't use when the length is known.
+		if names := trailerNames(header); len(names) > 0 {
+			header.Del("Content-Length")
+		} else if header.Get("Content-Length") != "" {
+			return false
+		}
+	}
+
+	// Values of declared trailers set before the headers are sent would be
+	// sent as headers, so move them to keys with the http.TrailerPrefix.
+	declared := declaredTrailers(header)
+	for _, n := range declared {
+		undeclareTrailer(header, n)
+	}
+	for _, n := range trailerNames(header) {
+		if !containsFold(declared, n) {
+			header.Add("Trailer", n)
+		}
+	}
+	return true
+}
+
+// bodyAllowed returns false if the response to the request can't have a
+// body, so neither can it have trailers.
+func bodyAllowed(r *http.Request, statusCode uint32) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	switch {
+	case statusCode >= 100 && statusCode <= 199,
+		statusCode == http.StatusNoContent,
+		statusCode == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// headerNames caches the sorted names of a header, so that reading them again
+// doesn't allocate. The next handler can change headers without the host
+// knowing, so each read checks the names still match, which doesn't allocate
+// either. Any mutation invalidates the cache.
+//
+// The names returned are shared, so must not be modified or retained after
+// the headers change.
+type headerNames struct {
+	names []string
+}
+
+// get returns the sorted names in the header, excluding trailers, plus the
+// extra name, unless empty.
+func (c *headerNames) get(header http.Header, extra string) []string {
+	if !c.matches(header, extra) {
+		c.names = appendSortedHeaderNames(c.names[:0], header, extra)
+	}
+	if len(c.names) == 0 {
+		return nil
+	}
+	return c.names
+}
+
+// reset clears the names, retaining capacity for the next request.
+func (c *headerNames) reset() headerNames {
+	return headerNames{names: c.names[:0]}
+}
+
+// matches returns true if the cached names are those get would return.
+func (c *headerNames) matches(header http.Header, extra string) bool {
+	count := 0
+	if extra != "" {
+		if !c.contains(extra) {
+			return false
+		}
+		count++
+	}
+	for n := range header {
+		if strings.HasPrefix(n, http.TrailerPrefix) {
+			continue
+		}
+		if !c.contains(n) {
+			return false
+		}
+		count++
+	}
+	return count == len(c.names)
+}
+
+func (c *headerNames) contains(name string) bool {
+	i := sort.SearchStrings(c.names, name)
+	return i < len(c.names) && c.names[i] == name
+}
+
+// appendSortedHeaderNames appends the sorted names get returns to names.
+func appendSortedHeaderNames(names []string, header http.Header, extra string) []string {
+	if extra != "" {
+		names = append(names, extra)
+	}
+	for n := range header {
+		if strings.HasPrefix(n, http.TrailerPrefix) {
+			continue
+		}
+		names = append(names, n)
+	}
+	// Keys in a Go map don't have consistent ordering.
+	sort.Strings(names)
+	return names
 }
 
 func trailerNames(header http.Header) (names []string) {
@@ -335,23 +863,94 @@ func trailerNames(header http.Header) (names []string) {
 			names = append(names, n)
 		}
 	}
+	// Handlers such as grpc-go instead declare trailers in the "Trailer"
+	// header, and set them without the prefix after WriteHeader.
+	for _, n := range declaredTrailers(header) {
+		if _, ok := header[n]; ok && !containsFold(names, n) {
+			names = append(names, n)
+		}
+	}
 	// Keys in a Go map don't have consistent ordering.
 	sort.Strings(names)
 	return
 }
 
 func getTrailers(header http.Header, name string) []string {
-	return header.Values(http.TrailerPrefix + name)
+	values := header[trailerKey(header, name)]
+	if isDeclaredTrailer(header, name) {
+		values = append(values, header.Values(name)...)
+	}
+	return values
 }
 
 func setTrailer(header http.Header, name string, value string) {
-	header.Set(http.TrailerPrefix+name, value)
+	undeclareTrailer(header, name)
+	header[trailerKey(header, name)] = []string{value}
 }
 
 func addTrailer(header http.Header, name string, value string) {
-	header.Set(http.TrailerPrefix+name, value)
+	undeclareTrailer(header, name)
+	key := trailerKey(header, name)
+	header[key] = append(header[key], value)
 }
 
 func removeTrailer(header http.Header, name string) {
-	header.Del(http.TrailerPrefix + name)
+	if isDeclaredTrailer(header, name) {
+		header.Del(name)
+	}
+	delete(header, trailerKey(header, name))
+}
+
+// declaredTrailers returns the canonical names in the "Trailer" header.
+func declaredTrailers(header http.Header) (names []string) {
+	for _, v := range header.Values("Trailer") {
+		for _, n := range strings.Split(v, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, http.CanonicalHeaderKey(n))
+			}
+		}
+	}
+	return
+}
+
+func isDeclaredTrailer(header http.Header, name string) bool {
+	return containsFold(declaredTrailers(header), name)
+}
+
+// undeclareTrailer moves any values of a declared trailer to the key with
+// the http.TrailerPrefix, so that there's only one place to change.
+func undeclareTrailer(header http.Header, name string) {
+	if !isDeclaredTrailer(header, name) {
+		return
+	}
+	if values := header.Values(name); len(values) > 0 {
+		key := trailerKey(header, name)
+		header[key] = append(header[key], values...)
+		header.Del(name)
+	}
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// trailerKey returns the header key of a trailer. http.Header methods don't
+// canonicalize keys with the http.TrailerPrefix, so this matches an existing
+// key case-insensitively, or returns the canonical key.
+func trailerKey(header http.Header, name string) string {
+	key := http.TrailerPrefix + http.CanonicalHeaderKey(name)
+	if _, ok := header[key]; ok {
+		return key
+	}
+	for k := range header {
+		if strings.HasPrefix(k, http.TrailerPrefix) && strings.EqualFold(k[len(http.TrailerPrefix):], name) {
+			return k
+		}
+	}
+	return key
 }
@@ -3,8 +3,17 @@ package wasm
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/httpwasm/http-wasm-host-go/api/handler"
@@ -43,3 +52,341 @@ func Test_host_GetProtocolVersion(t *testing.T) {
 		})
 	}
 }
+
+func Test_host_Addr(t *testing.T) {
+	r, _ := http.NewRequest("GET", "", nil)
+	r.RemoteAddr = "192.0.2.1:51234"
+	localAddr := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 443}
+	r = r.WithContext(context.WithValue(testCtx, http.LocalAddrContextKey, localAddr))
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+	h := host{}
+	if want, have := "192.0.2.1:51234", h.GetRemoteAddr(ctx); want != have {
+		t.Errorf("unexpected remote addr, want: %v, have: %v", want, have)
+	}
+	if want, have := "192.0.2.2:443", h.GetLocalAddr(ctx); want != have {
+		t.Errorf("unexpected local addr, want: %v, have: %v", want, have)
+	}
+}
+
+func Test_host_TLS(t *testing.T) {
+	spiffeID, _ := url.Parse("spiffe://example.com/client")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "client", Organization: []string{"Example"}},
+		DNSNames:       []string{"client.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("192.0.2.1")},
+		EmailAddresses: []string{"client@example.com"},
+		URIs:           []*url.URL{spiffeID},
+	}
+
+	r, _ := http.NewRequest("GET", "", nil)
+	r.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		ServerName:       "example.com",
+		PeerCertificates: []*x509.Certificate{cert},
+	}
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+	h := host{}
+	if want, have := "TLS 1.3", h.GetTLSVersion(ctx); want != have {
+		t.Errorf("unexpected TLS version, want: %v, have: %v", want, have)
+	}
+	if want, have := "TLS_AES_128_GCM_SHA256", h.GetTLSCipherSuite(ctx); want != have {
+		t.Errorf("unexpected TLS cipher suite, want: %v, have: %v", want, have)
+	}
+	if want, have := "example.com", h.GetTLSServerName(ctx); want != have {
+		t.Errorf("unexpected TLS server name, want: %v, have: %v", want, have)
+	}
+	if want, have := "CN=client,O=Example", h.GetTLSPeerSubject(ctx); want != have {
+		t.Errorf("unexpected TLS peer subject, want: %v, have: %v", want, have)
+	}
+	wantSANs := []string{
+		"DNS:client.example.com",
+		"IP:192.0.2.1",
+		"email:client@example.com",
+		"URI:spiffe://example.com/client",
+	}
+	if want, have := wantSANs, h.GetTLSPeerSANs(ctx); !reflect.DeepEqual(want, have) {
+		t.Errorf("unexpected TLS peer SANs, want: %v, have: %v", want, have)
+	}
+}
+
+func Test_announceTrailers(t *testing.T) {
+	tests := []struct {
+		name          string
+		method, proto string
+		statusCode    uint32
+		header        http.Header
+		want          bool
+		wantHeader    http.Header
+	}{
+		{
+			name:       "HTTP/1.1 no trailers",
+			method:     "GET",
+			proto:      "HTTP/1.1",
+			statusCode: 200,
+			header:     http.Header{},
+			want:       true,
+			wantHeader: http.Header{},
+		},
+		{
+			name:       "HTTP/1.1 content length",
+			method:     "GET",
+			proto:      "HTTP/1.1",
+			statusCode: 200,
+			header:     http.Header{"Content-Length": {"5"}},
+			wantHeader: http.Header{"Content-Length": {"5"}},
+		},
+		{
+			name:       "HTTP/1.1 trailers remove content length",
+			method:     "GET",
+			proto:      "HTTP/1.1",
+			statusCode: 200,
+			header:     http.Header{"Content-Length": {"5"}, "Trailer:Grpc-Status": {"0"}},
+			want:       true,
+			wantHeader: http.Header{"Trailer": {"Grpc-Status"}, "Trailer:Grpc-Status": {"0"}},
+		},
+		{
+			name:       "HTTP/2.0 content length",
+			method:     "GET",
+			proto:      "HTTP/2.0",
+			statusCode: 200,
+			header:     http.Header{"Content-Length": {"5"}, "Trailer:Grpc-Status": {"0"}},
+			want:       true,
+			wantHeader: http.Header{"Content-Length": {"5"}, "Trailer": {"Grpc-Status"}, "Trailer:Grpc-Status": {"0"}},
+		},
+		{
+			name:       "already declared",
+			method:     "GET",
+			proto:      "HTTP/2.0",
+			statusCode: 200,
+			header:     http.Header{"Trailer": {"grpc-status"}, "Trailer:Grpc-Status": {"0"}, "Trailer:X-Sum": {"1"}},
+			want:       true,
+			wantHeader: http.Header{"Trailer": {"grpc-status", "X-Sum"}, "Trailer:Grpc-Status": {"0"}, "Trailer:X-Sum": {"1"}},
+		},
+		{
+			name:       "HEAD",
+			method:     "HEAD",
+			proto:      "HTTP/2.0",
+			statusCode: 200,
+			header:     http.Header{},
+			wantHeader: http.Header{},
+		},
+		{
+			name:       "not modified",
+			method:     "GET",
+			proto:      "HTTP/2.0",
+			statusCode: 304,
+			header:     http.Header{},
+			wantHeader: http.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := http.NewRequest(tc.method, "", nil)
+			r.ProtoMajor, r.ProtoMinor, _ = http.ParseHTTPVersion(tc.proto)
+
+			if want, have := tc.want, announceTrailers(r, tc.statusCode, tc.header); want != have {
+				t.Errorf("unexpected result, want: %v, have: %v", want, have)
+			}
+			if want, have := tc.wantHeader, tc.header; !reflect.DeepEqual(want, have) {
+				t.Errorf("unexpected header, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
+// Test_host_ResponseTrailers_notSendable ensures changing response trailers
+// fails once headers were sent without a way to send trailers.
+func Test_host_ResponseTrailers_notSendable(t *testing.T) {
+	r, _ := http.NewRequest("GET", "", nil)
+	w := &streamingResponseWriter{
+		delegate:   httptest.NewRecorder(),
+		request:    r,
+		sentHeader: true,
+	}
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r, w: w})
+
+	defer func() {
+		want := "can't change response trailers: response headers were sent without chunked encoding"
+		if have := recover(); have == nil || have.(error).Error() != want {
+			t.Errorf("unexpected panic, want: %q, have: %v", want, have)
+		}
+	}()
+	host{}.SetResponseTrailerValue(ctx, "grpc-status", "0")
+}
+
+// Test_host_RequestBodyReader_replay ensures a partial read of the request
+// body leaves the original bytes for the next handler.
+func Test_host_RequestBodyReader_replay(t *testing.T) {
+	const body = "hello world"
+	r, _ := http.NewRequest("POST", "/", nil)
+	r.Body = &bufferingRequestBody{delegate: io.NopCloser(strings.NewReader(body)), length: -1}
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+	partial := make([]byte, 5)
+	if _, err := io.ReadFull(host{}.RequestBodyReader(ctx), partial); err != nil {
+		t.Fatal(err)
+	} else if want, have := "hello", string(partial); want != have {
+		t.Errorf("unexpected partial read, want: %q, have: %q", want, have)
+	}
+
+	replayed, err := io.ReadAll(r.Body.(*bufferingRequestBody).replay())
+	if err != nil {
+		t.Fatal(err)
+	} else if want, have := body, string(replayed); want != have {
+		t.Errorf("unexpected replayed body, want: %q, have: %q", want, have)
+	}
+}
+
+// Test_host_ResponseBodyWriter_interleaved ensures rewriting a buffered
+// response body doesn't change what a reader of the original has yet to read.
+func Test_host_ResponseBodyWriter_interleaved(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int64
+	}{
+		{name: "in memory"},
+		{name: "spilled", threshold: 2},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r, _ := http.NewRequest("GET", "/", nil)
+			w := &bufferingResponseWriter{
+				delegate: httptest.NewRecorder(),
+				body:     spillBuffer{threshold: tc.threshold, dir: dir},
+			}
+			if _, err := w.Write([]byte("hello world")); err != nil {
+				t.Fatal(err)
+			}
+			s := &requestState{r: r, w: w}
+			ctx := context.WithValue(testCtx, requestStateKey{}, s)
+
+			h := host{}
+			body := h.ResponseBodyReader(ctx)
+			partial := make([]byte, 5)
+			if _, err := io.ReadFull(body, partial); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := h.ResponseBodyWriter(ctx).Write([]byte("HELLO WORLD")); err != nil {
+				t.Fatal(err)
+			}
+
+			if rest, err := io.ReadAll(body); err != nil {
+				t.Fatal(err)
+			} else if want, have := " world", string(rest); want != have {
+				t.Errorf("unexpected original body, want: %q, have: %q", want, have)
+			}
+			if rewritten, err := io.ReadAll(w.body.Reader()); err != nil {
+				t.Fatal(err)
+			} else if want, have := "HELLO WORLD", string(rewritten); want != have {
+				t.Errorf("unexpected rewritten body, want: %q, have: %q", want, have)
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			requireFileCount(t, dir, false)
+		})
+	}
+}
+
+// Test_host_SetScheme ensures schemes other than HTTP's are rejected.
+func Test_host_SetScheme(t *testing.T) {
+	tests := []struct {
+		scheme, want string
+	}{
+		{scheme: "http", want: "http"},
+		{scheme: "HTTPS", want: "https"},
+		{scheme: "ftp"},
+		{scheme: "http:"},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.scheme, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+			defer func() {
+				have := recover()
+				if tc.want != "" {
+					if have != nil {
+						t.Errorf("unexpected panic: %v", have)
+					} else if r.URL.Scheme != tc.want {
+						t.Errorf("unexpected scheme, want: %v, have: %v", tc.want, r.URL.Scheme)
+					}
+				} else if want := fmt.Sprintf("invalid scheme: %q", tc.scheme); have == nil || have.(error).Error() != want {
+					t.Errorf("unexpected panic, want: %q, have: %v", want, have)
+				}
+			}()
+			host{}.SetScheme(ctx, tc.scheme)
+		})
+	}
+}
+
+// Test_host_GetRequestHeaderNames_cached ensures header names are cached
+// without allocation until the headers change, including by the next handler.
+func Test_host_GetRequestHeaderNames_cached(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://localhost", nil)
+	r.Header.Set("Accept", "*/*")
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+	h := host{}
+	if want, have := []string{"Accept", "Host"}, h.GetRequestHeaderNames(ctx); !reflect.DeepEqual(want, have) {
+		t.Fatalf("unexpected names, want: %v, have: %v", want, have)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { h.GetRequestHeaderNames(ctx) }); allocs != 0 {
+		t.Fatalf("expected no allocations, have %v", allocs)
+	}
+
+	h.SetRequestHeaderValue(ctx, "Via", "1.1 wasm")
+	if want, have := []string{"Accept", "Host", "Via"}, h.GetRequestHeaderNames(ctx); !reflect.DeepEqual(want, have) {
+		t.Fatalf("unexpected names, want: %v, have: %v", want, have)
+	}
+
+	// Changes outside the host are also visible.
+	r.Header.Del("Accept")
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Host = ""
+	if want, have := []string{"Accept-Encoding", "Via"}, h.GetRequestHeaderNames(ctx); !reflect.DeepEqual(want, have) {
+		t.Fatalf("unexpected names, want: %v, have: %v", want, have)
+	}
+}
+
+func Benchmark_host_GetRequestHeaderNames(b *testing.B) {
+	r, _ := http.NewRequest("GET", "http://localhost", nil)
+	r.Header.Set("Accept", "*/*")
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	r.Header.Set("User-Agent", "benchmark")
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+	h := host{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.GetRequestHeaderNames(ctx)
+	}
+}
+
+func Benchmark_host_GetResponseHeaderNames(b *testing.B) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{w: w})
+
+	h := host{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.GetResponseHeaderNames(ctx)
+	}
+}
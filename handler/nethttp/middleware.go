@@ -1,10 +1,14 @@
 package wasm
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 
 	handlerapi "github.com/httpwasm/http-wasm-host-go/api/handler"
 	"github.com/httpwasm/http-wasm-host-go/handler"
@@ -31,29 +35,140 @@ func NewMiddleware(ctx context.Context, guest []byte, options ...handler.Option)
 // pointer to the current request.
 type requestStateKey struct{}
 
+// requestState is the state of the current request. It is also the
+// context.Context passed to the guest, so that host functions can find it
+// without allocating a context value. States are pooled, so must not be used
+// after Close, except by a streaming body or writer the next handler retained:
+// states that streamed aren't pooled.
 type requestState struct {
+	// Context is the context of the request.
+	context.Context
+
 	w        http.ResponseWriter
 	r        *http.Request
 	next     http.Handler
 	features handlerapi.Features
+	limits   handler.Limits
+	policy   handler.RewritePolicy
+
+	// rewrittenRequest is the request body written by the guest, if any,
+	// until headers are reconciled with it.
+	rewrittenRequest *bytes.Buffer
+
+	// requestBuffer is the request body buffer, if any, retained until Close
+	// as the next handler may read it.
+	requestBuffer *spillBuffer
+
+	// mu serializes calls to the guest while streaming, as the next handler
+	// may read the request body and write the response on different
+	// goroutines.
+	mu sync.Mutex
+
+	// streaming is true when the request body or response is streamed
+	// through the guest, so the state isn't pooled.
+	streaming bool
+
+	// upgrade is true when the request asks to upgrade the connection, so
+	// bodies are neither buffered nor streamed.
+	upgrade bool
+
+	// requestHeaderNames and responseHeaderNames cache header names read by
+	// the guest.
+	requestHeaderNames, responseHeaderNames headerNames
+
+	// recorder wraps the response writer the host was given, and is the
+	// innermost delegate of w.
+	recorder recordingResponseWriter
+
+	// wrappedRecorder is the recorder implementing recorderFeatures, kept
+	// when pooled to avoid allocating it for each request.
+	wrappedRecorder  http.ResponseWriter
+	recorderFeatures recorderFeatures
 }
 
+// requestStatePool reuses states of completed requests.
+var requestStatePool sync.Pool
+
 func newRequestState(w http.ResponseWriter, r *http.Request, g *guest) *requestState {
-	s := &requestState{w: w, r: r, next: g.next}
+	s, _ := requestStatePool.Get().(*requestState)
+	if s == nil {
+		s = &requestState{}
+	}
+	s.Context, s.r, s.next, s.limits, s.policy = r.Context(), r, g.next, g.limits, g.policy
+	s.upgrade = isUpgradeRequest(r)
+	s.recorder = recordingResponseWriter{ResponseWriter: w, upgrade: s.upgrade}
+	if f := recorderFeaturesOf(w); s.wrappedRecorder == nil || f != s.recorderFeatures {
+		s.wrappedRecorder, s.recorderFeatures = s.recorder.wrap(f), f
+	}
+	s.w = s.wrappedRecorder
 	s.enableFeatures(g.features)
 	return s
 }
 
-func (s *requestState) enableFeatures(features handlerapi.Features) {
+// enableFeatures enables the features for the request, returning all those
+// enabled, which excludes any unsupported by the request.
+func (s *requestState) enableFeatures(features handlerapi.Features) handlerapi.Features {
+	if s.upgrade {
+		features &^= upgradeUnsupported
+	}
 	s.features = s.features.WithEnabled(features)
-	if features.IsEnabled(handlerapi.FeatureBufferRequest) {
-		s.r.Body = &bufferingRequestBody{delegate: s.r.Body}
+	if _, ok := s.r.Body.(*bufferingRequestBody); !ok && // don't double-wrap
+		features.IsEnabled(handlerapi.FeatureBufferRequest) {
+		br := &bufferingRequestBody{
+			delegate: s.r.Body,
+			buffer:   spillBuffer{threshold: s.limits.SpillThreshold, dir: s.limits.SpillDir},
+			limit:    s.limits.MaxRequestBuffer,
+			length:   s.r.ContentLength,
+		}
+		s.r.Body, s.requestBuffer = br, &br.buffer
 	}
 	if s.features.IsEnabled(handlerapi.FeatureBufferResponse) {
 		if _, ok := s.w.(*bufferingResponseWriter); !ok { // don't double-wrap
-			s.w = &bufferingResponseWriter{delegate: s.w}
+			s.w = &bufferingResponseWriter{
+				delegate: s.w,
+				body:     spillBuffer{threshold: s.limits.SpillThreshold, dir: s.limits.SpillDir},
+				limit:    s.limits.MaxResponseBuffer,
+				policy:   s.policy,
+				request:  s.r,
+			}
 		}
 	}
+	return s.features
+}
+
+// Value implements the same method as documented on context.Context.
+func (s *requestState) Value(key any) any {
+	if key == (requestStateKey{}) {
+		return s
+	}
+	return s.Context.Value(key)
+}
+
+// Close releases resources held for the request, such as temporary files of
+// buffered bodies, then puts the state back into the pool.
+func (s *requestState) Close() (err error) {
+	if b := s.requestBuffer; b != nil {
+		err = b.Reset()
+		s.requestBuffer = nil
+	}
+	if bw, ok := s.w.(*bufferingResponseWriter); ok {
+		if resetErr := bw.Close(); err == nil {
+			err = resetErr
+		}
+	}
+	if s.streaming {
+		// The next handler may have retained the streaming body or writer,
+		// which lock mu, so the state can't be reused.
+		return
+	}
+	*s = requestState{
+		requestHeaderNames:  s.requestHeaderNames.reset(),
+		responseHeaderNames: s.responseHeaderNames.reset(),
+		wrappedRecorder:     s.wrappedRecorder,
+		recorderFeatures:    s.recorderFeatures,
+	}
+	requestStatePool.Put(s)
+	return
 }
 
 func (s *requestState) handleNext() (err error) {
@@ -67,31 +182,87 @@ func (s *requestState) handleNext() (err error) {
 		}
 	}()
 
-	// If we set the intercepted the request body for any reason, reset it
-	// before calling downstream.
+	s.resetRequestBody()
+	s.next.ServeHTTP(s.w, s.r)
+	return
+}
+
+// resetRequestBody resets the request body if we intercepted it for any
+// reason, before calling downstream. If the guest overwrote it, this also
+// reconciles the request headers.
+func (s *requestState) resetRequestBody() {
 	if br, ok := s.r.Body.(*bufferingRequestBody); ok {
-		if br.buffer.Len() == 0 {
-			s.r.Body = br.delegate
-		} else {
-			br.Close() // nolint
-			s.r.Body = io.NopCloser(&br.buffer)
+		s.r.Body = br.replay()
+	}
+	if b := s.rewrittenRequest; b != nil {
+		s.rewrittenRequest = nil
+		length := int64(b.Len())
+		if s.policy&handler.RewriteContentLength != 0 {
+			s.r.ContentLength = length
 		}
+		fixHeaders(s.r.Header, s.policy, length)
 	}
-	s.next.ServeHTTP(s.w, s.r)
+}
+
+// enableStreaming wraps the request body and response writer, so that the
+// guest handles their chunks, when the corresponding features are enabled.
+func (s *requestState) enableStreaming(ctx context.Context, reqCtx uint32, g *guest) (sb *streamingRequestBody, sw *streamingResponseWriter) {
+	if s.features.IsEnabled(handlerapi.FeatureStreamRequest) {
+		s.resetRequestBody()
+		sb = &streamingRequestBody{
+			delegate: s.r.Body,
+			buf:      make([]byte, g.limits.MaxInFlight),
+			mu:       &s.mu,
+			// handleChunk holds the lock.
+			handleBody: func(endOfStream bool) error {
+				return g.handleRequestBody(ctx, reqCtx, endOfStream)
+			},
+		}
+		s.r.Body = sb
+		// The length of the transformed body is unknown.
+		if s.policy&handler.RewriteContentLength != 0 {
+			s.r.ContentLength = -1
+		}
+		fixHeaders(s.r.Header, s.policy, -1)
+	}
+	if s.features.IsEnabled(handlerapi.FeatureStreamResponse) &&
+		!s.features.IsEnabled(handlerapi.FeatureBufferResponse) {
+		sw = &streamingResponseWriter{
+			delegate: s.w,
+			policy:   s.policy,
+			request:  s.r,
+			handleBody: func(endOfStream bool) error {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				return g.handleResponseBody(ctx, reqCtx, endOfStream)
+			},
+		}
+		s.w = sw
+	}
+	s.streaming = sb != nil || sw != nil
 	return
 }
 
+// requestStateFromContext returns the state of the current request, which is
+// the context or one of its parents.
 func requestStateFromContext(ctx context.Context) *requestState {
+	if s, ok := ctx.(*requestState); ok {
+		return s
+	}
 	return ctx.Value(requestStateKey{}).(*requestState)
 }
 
 // NewHandler implements the same method as documented on handler.Middleware.
 func (w *middleware) NewHandler(_ context.Context, next http.Handler) http.Handler {
 	return &guest{
-		handleRequest:  w.m.HandleRequest,
-		handleResponse: w.m.HandleResponse,
-		next:           next,
-		features:       w.m.Features(),
+		handleRequest:      w.m.HandleRequest,
+		handleResponse:     w.m.HandleResponse,
+		handleResponseBody: w.m.HandleResponseBody,
+		handleRequestBody:  w.m.HandleRequestBody,
+		next:               next,
+		features:           w.m.Features(),
+		limits:             w.m.Limits(),
+		policy:             w.m.RewritePolicy(),
 	}
 }
 
@@ -101,10 +272,14 @@ func (w *middleware) Close(ctx context.Context) error {
 }
 
 type guest struct {
-	handleRequest  func(ctx context.Context) (outCtx context.Context, ctxNext handlerapi.CtxNext, err error)
-	handleResponse func(ctx context.Context, reqCtx uint32, err error) error
-	next           http.Handler
-	features       handlerapi.Features
+	handleRequest      func(ctx context.Context) (outCtx context.Context, ctxNext handlerapi.CtxNext, err error)
+	handleResponse     func(ctx context.Context, reqCtx uint32, err error) error
+	handleResponseBody func(ctx context.Context, reqCtx uint32, endOfStream bool) error
+	handleRequestBody  func(ctx context.Context, reqCtx uint32, endOfStream bool) error
+	next               http.Handler
+	features           handlerapi.Features
+	limits             handler.Limits
+	policy             handler.RewritePolicy
 }
 
 // ServeHTTP implements http.Handler
@@ -112,10 +287,20 @@ func (g *guest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// The guest Wasm actually handles the request. As it may call host
 	// functions, we add context parameters of the current request.
 	s := newRequestState(w, r, g)
-	ctx := context.WithValue(r.Context(), requestStateKey{}, s)
-	outCtx, ctxNext, requestErr := g.handleRequest(ctx)
+	defer s.Close() // nolint
+	outCtx, ctxNext, requestErr := g.handleRequest(s)
 	if requestErr != nil {
-		handleErr(w, requestErr)
+		var limitErr *handlerapi.BufferLimitError
+		tooLarge := errors.As(requestErr, &limitErr) && limitErr.Kind == handlerapi.BodyKindRequest
+		switch {
+		case tooLarge && isGRPCRequest(r):
+			// gRPC clients expect a status, rather than an HTTP error.
+			handleGRPCErr(w, grpcResourceExhausted, limitErr)
+		case tooLarge:
+			handleErr(w, int(g.limits.RequestTooLargeStatus), requestErr)
+		default:
+			handleErr(w, http.StatusInternalServerError, requestErr)
+		}
 	}
 
 	// If buffering was enabled, ensure it flushes.
@@ -129,17 +314,50 @@ func (g *guest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Otherwise, the host calls the next handler.
+	// Otherwise, the host calls the next handler, streaming bodies through
+	// the guest if enabled.
+	reqCtx := uint32(ctxNext >> 32)
+	sb, sw := s.enableStreaming(outCtx, reqCtx, g)
 	err := s.handleNext()
+	if sw != nil && err == nil {
+		err = sw.release()
+	}
+	if sb != nil {
+		// The next handler may retain the body, but can't read it anymore.
+		sb.detach()
+		if err == nil {
+			err = sb.guestErr
+		}
+	}
+	if bw, ok := s.w.(*bufferingResponseWriter); ok && err == nil {
+		err = bw.err // the response body exceeded its limit
+	}
 
 	// Finally, call the guest with the response or error
-	if err = g.handleResponse(outCtx, uint32(ctxNext>>32), err); err != nil {
+	if err = g.handleResponse(outCtx, reqCtx, err); err != nil {
 		panic(err)
 	}
 }
 
-func handleErr(w http.ResponseWriter, requestErr error) {
+func handleErr(w http.ResponseWriter, statusCode int, requestErr error) {
 	// TODO: after testing, shouldn't send errors into the HTTP response.
-	w.WriteHeader(500)
+	w.WriteHeader(statusCode)
 	w.Write([]byte(requestErr.Error())) // nolint
 }
+
+// grpcResourceExhausted is the gRPC status code RESOURCE_EXHAUSTED.
+const grpcResourceExhausted = 8
+
+// isGRPCRequest returns true if the request is a gRPC call.
+func isGRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// handleGRPCErr responds with a gRPC status in a "Trailers-Only" response.
+// The message of requestErr must not need percent-encoding.
+func handleGRPCErr(w http.ResponseWriter, code int, requestErr error) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", requestErr.Error())
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,14 +1,29 @@
 package wasm_test
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/httpwasm/http-wasm-host-go/api"
 	handlerapi "github.com/httpwasm/http-wasm-host-go/api/handler"
 	"github.com/httpwasm/http-wasm-host-go/handler"
 	wasm "github.com/httpwasm/http-wasm-host-go/handler/nethttp"
@@ -170,6 +185,81 @@ func TestURI(t *testing.T) {
 	}
 }
 
+// TestQuery uses test.BinE2EQuery which ensures query parameters are decoded
+// when read and re-encoded when changed.
+func TestQuery(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, have := "/disney?name=teddy&tag=a%26b", r.RequestURI; want != have {
+			t.Fatalf("unexpected request URI, want: %q, have: %q", want, have)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := "chip&dale", string(body); want != have {
+			t.Fatalf("unexpected request body, want: %q, have: %q", want, have)
+		}
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/disney?name=chip%26dale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("invalid status code: %d, status message: %s", resp.StatusCode, resp.Status)
+	}
+}
+
+// TestAuthority uses test.BinE2EAuthority which ensures the authority is the
+// same as the "Host" header in HTTP/1.1 and the ":authority" pseudo-header in
+// HTTP/2.0.
+func TestAuthority(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EAuthority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, have := "example.com", r.Host; want != have {
+			t.Fatalf("unexpected request host, want: %q, have: %q", want, have)
+		}
+	})
+
+	for _, http2 := range []bool{false, true} {
+		ts := httptest.NewUnstartedServer(mw.NewHandler(testCtx, next))
+		ts.EnableHTTP2 = http2
+		ts.StartTLS()
+
+		resp, err := ts.Client().Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if http2 && resp.ProtoMajor != 2 {
+			t.Fatalf("expected HTTP/2.0, have: %s", resp.Proto)
+		}
+		if want, have := ts.URL, string(body); want != have {
+			t.Fatalf("%s: unexpected response body, want: %q, have: %q", resp.Proto, want, have)
+		}
+	}
+}
+
 // TestHeaderNames uses test.BinE2EHeaderNames which ensures count/len are
 // correct.
 func TestHeaderNames(t *testing.T) {
@@ -215,10 +305,115 @@ func TestHeaderValue(t *testing.T) {
 	defer resp.Body.Close()
 }
 
-// TestHandleResponse uses test.BinE2EHandleResponse which ensures reqCtx
-// propagates from handler.FuncHandleRequest to handler.FuncHandleResponse.
-func TestHandleResponse(t *testing.T) {
-	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EHandleResponse)
+// TestCookie uses test.BinE2ECookie which reads a request cookie and sets a
+// response cookie.
+func TestCookie(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2ECookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, noopHandler))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Cookie", "theme=dark; session=1")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "1", string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+	want := "session=2; Path=/; Max-Age=3600; HttpOnly; Secure; SameSite=Lax"
+	if have := resp.Header.Get("Set-Cookie"); want != have {
+		t.Fatalf("unexpected Set-Cookie, want: %q, have: %q", want, have)
+	}
+}
+
+// TestForm uses test.BinE2EForm which writes form values and file headers to
+// the response body, before the next handler echoes the request body.
+func TestForm(t *testing.T) {
+	var multipartBody bytes.Buffer
+	mpw := multipart.NewWriter(&multipartBody)
+	mpw.WriteField("name", "chip") // nolint
+	fw, _ := mpw.CreateFormFile("upload", "acorn.txt")
+	fw.Write([]byte("nuts"))       // nolint
+	mpw.WriteField("name", "dale") // nolint
+	mpw.Close()                    // nolint
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{
+			name:        "urlencoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=chip&name=dale",
+			expected:    "chip\x00dale\x00",
+		},
+		{
+			name:        "multipart",
+			contentType: mpw.FormDataContentType(),
+			body:        multipartBody.String(),
+			expected: "chip\x00dale\x00" +
+				"Content-Disposition: form-data; name=\"upload\"; filename=\"acorn.txt\"\x00" +
+				"Content-Type: application/octet-stream\x00",
+		},
+		{
+			name:        "not a form",
+			contentType: "text/plain",
+			body:        "name=chip",
+		},
+	}
+
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EForm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	// The next handler echoes the request body, to show it wasn't consumed.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body) // nolint
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := ts.Client().Post(ts.URL, tc.contentType, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := tc.expected+tc.body, string(body); want != have {
+				t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// TestForm_MaxFormSize ensures the request fails when the form is larger than
+// handler.MaxFormSize.
+func TestForm_MaxFormSize(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EForm, handler.MaxFormSize(8))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -227,12 +422,1505 @@ func TestHandleResponse(t *testing.T) {
 	ts := httptest.NewServer(mw.NewHandler(testCtx, noopHandler))
 	defer ts.Close()
 
+	resp, err := ts.Client().Post(ts.URL, "application/x-www-form-urlencoded",
+		strings.NewReader("name=chip&name=dale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if want, have := http.StatusInternalServerError, resp.StatusCode; want != have {
+		t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+	}
+}
+
+// TestForm_KeepsHeaders ensures parsing a form replays the original body to
+// the next handler, instead of rewriting it along with its headers.
+func TestForm_KeepsHeaders(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EForm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	body := "name=chip&name=dale"
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%d %s ", r.ContentLength, r.Header.Get("Content-MD5")) // nolint
+		io.Copy(w, r.Body)                                                     // nolint
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-MD5", "md5")
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	have, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The guest writes the form values before the next handler.
+	want := "chip\x00dale\x00" + strconv.Itoa(len(body)) + " md5 " + body
+	if have := string(have); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+}
+
+// TestStreamResponse uses test.BinE2EStreamResponse which transforms each
+// chunk of the response body, as the next handler writes it.
+func TestStreamResponse(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EStreamResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello ")) // nolint
+		w.(http.Flusher).Flush()
+		w.Header().Set("X-Late", "1") // ignored as headers were sent
+		w.Write([]byte("#raw "))      // nolint
+		w.Write([]byte("world"))      // nolint
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
 	resp, err := ts.Client().Get(ts.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		t.Fatalf("invalid status code: %d, status message: %s", resp.StatusCode, resp.Status)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "HELLO #raw WORLD!", string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+	if want, have := http.StatusCreated, resp.StatusCode; want != have {
+		t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+	}
+	if want, have := "text/plain", resp.Header.Get("Content-Type"); want != have {
+		t.Fatalf("unexpected Content-Type, want: %q, have: %q", want, have)
+	}
+	if have := resp.Header.Get("X-Late"); have != "" {
+		t.Fatalf("unexpected X-Late: %q", have)
+	}
+}
+
+// TestStreamResponse_RequiresExport ensures handler.FeatureStreamResponse
+// can't be enabled by a guest that doesn't export
+// handlerapi.FuncHandleResponseBody.
+func TestStreamResponse_RequiresExport(t *testing.T) {
+	guestConfig := make([]byte, 8)
+	binary.LittleEndian.PutUint64(guestConfig, uint64(handlerapi.FeatureStreamResponse))
+
+	// test.BinExampleConfig traps if none of the required features are enabled.
+	mw, err := wasm.NewMiddleware(testCtx, test.BinExampleConfig, handler.GuestConfig(guestConfig))
+	if err == nil {
+		mw.Close(testCtx)
+		t.Fatal("expected an error enabling stream_response")
+	}
+}
+
+// TestStreamRequest uses test.BinE2EStreamRequest which transforms each
+// chunk of the request body, as the next handler reads it.
+func TestStreamRequest(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EStreamRequest, handler.MaxInFlight(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	var body []byte
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, have := int64(-1), r.ContentLength; want != have {
+			t.Fatalf("unexpected content length, want: %d, have: %d", want, have)
+		}
+		if have := r.Header.Get("Content-Length"); have != "" {
+			t.Fatalf("unexpected Content-Length: %q", have)
+		}
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Use a recorder, so that the body is read in chunks of MaxInFlight.
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("chip#dale"))
+	req.Header.Set("Content-Length", "9")
+	mw.NewHandler(testCtx, next).ServeHTTP(httptest.NewRecorder(), req)
+
+	if want, have := "CHIP|#dalE|!", string(body); want != have {
+		t.Fatalf("unexpected request body, want: %q, have: %q", want, have)
+	}
+}
+
+// TestStreamRequest_Unread ensures the guest isn't called when the next
+// handler doesn't read the request body.
+func TestStreamRequest_Unread(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EStreamRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	body := &countingReader{r: strings.NewReader("chip")}
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	mw.NewHandler(testCtx, noopHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+	if body.reads != 0 {
+		t.Fatalf("expected the request body to be unread, have %d reads", body.reads)
+	}
+}
+
+// TestStreamRequest_ReadAfterReturn ensures reading the request body after
+// the next handler returned fails instead of calling the guest.
+func TestStreamRequest_ReadAfterReturn(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EStreamRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	var body io.Reader
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = r.Body
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("chip"))
+	mw.NewHandler(testCtx, next).ServeHTTP(httptest.NewRecorder(), req)
+
+	if _, err = body.Read(make([]byte, 4)); err != http.ErrBodyReadAfterClose {
+		t.Fatalf("unexpected error, want: %v, have: %v", http.ErrBodyReadAfterClose, err)
+	}
+}
+
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+// TestMaxRequestBuffer ensures a request body larger than
+// handler.MaxRequestBuffer fails with the configured status.
+func TestMaxRequestBuffer(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    []handler.Option
+		statusCode int
+	}{
+		{
+			name:       "default status",
+			options:    []handler.Option{handler.MaxRequestBuffer(4)},
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "configured status",
+			options:    []handler.Option{handler.MaxRequestBuffer(4), handler.RequestTooLargeStatus(400)},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "under limit",
+			options:    []handler.Option{handler.MaxRequestBuffer(11)},
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			options := append([]handler.Option{handler.GuestConfig([]byte("open sesame"))}, tc.options...)
+			mw, err := wasm.NewMiddleware(testCtx, test.BinExampleRedact, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, noopHandler))
+			defer ts.Close()
+
+			resp, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader("hello world"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := tc.statusCode, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+		})
+	}
+}
+
+// TestMaxResponseBuffer ensures a response body larger than
+// handler.MaxResponseBuffer fails with handlerapi.BufferLimitError.
+func TestMaxResponseBuffer(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinExampleRedact,
+		handler.GuestConfig([]byte("open sesame")), handler.MaxResponseBuffer(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	var writeErr error
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, writeErr = w.Write([]byte("hello world"))
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var limitErr *handlerapi.BufferLimitError
+	if !errors.As(writeErr, &limitErr) {
+		t.Fatalf("expected a BufferLimitError, have: %v", writeErr)
+	} else if want, have := handlerapi.BodyKindResponse, limitErr.Kind; want != have {
+		t.Fatalf("unexpected body kind, want: %d, have: %d", want, have)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusInternalServerError, resp.StatusCode; want != have {
+		t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+	}
+	if want, have := limitErr.Error(), string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+}
+
+// TestSpillToDisk ensures buffered bodies larger than the threshold are
+// written to temporary files, which are removed after the request.
+func TestSpillToDisk(t *testing.T) {
+	dir := t.TempDir()
+	mw, err := wasm.NewMiddleware(testCtx, test.BinExampleRedact,
+		handler.GuestConfig([]byte("open sesame")), handler.SpillToDisk(4, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	var spilled int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(body) // nolint
+		entries, _ := os.ReadDir(dir)
+		spilled = len(entries)
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	resp, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader("hello open sesame world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "hello ########### world", string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+	if spilled == 0 {
+		t.Fatal("expected the buffered bodies to spill to disk")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected temporary files to be removed, have: %d", len(entries))
+	}
+}
+
+// TestBufferRequest uses test.BinE2EReadBodyRequest which reads a limited
+// amount of the request body, to ensure the next handler sees the original.
+func TestBufferRequest(t *testing.T) {
+	body := strings.Repeat("abcdefgh", 625) // 5000 bytes
+
+	tests := []struct {
+		name    string
+		limit   uint32
+		options []handler.Option
+	}{
+		{name: "zero-length read", limit: 0},
+		{name: "partial read", limit: 5},
+		{name: "partial read over chunks", limit: 2050},
+		{name: "full read", limit: 5000},
+		{name: "read past EOF", limit: 8192},
+		{
+			// Only what the guest reads counts against the limit.
+			name:    "partial read under MaxRequestBuffer",
+			limit:   5,
+			options: []handler.Option{handler.MaxRequestBuffer(100)},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			guestConfig := make([]byte, 4)
+			binary.LittleEndian.PutUint32(guestConfig, tc.limit)
+			options := append([]handler.Option{handler.GuestConfig(guestConfig)}, tc.options...)
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EReadBodyRequest, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			var nextBody []byte
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				if nextBody, err = io.ReadAll(r.Body); err != nil {
+					t.Error(err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if want, have := http.StatusOK, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if want, have := body, string(nextBody); want != have {
+				t.Fatalf("unexpected request body, want %d bytes, have %d: %q", len(want), len(have), have)
+			}
+		})
+	}
+}
+
+// TestBodyLen uses test.BinE2EBodyLen which reads a body in one call sized by
+// handler.FuncBodyLen, and echoes it.
+func TestBodyLen(t *testing.T) {
+	body := strings.Repeat("abcdefgh", 625) // 5000 bytes
+
+	tests := []struct {
+		name     string
+		kind     handlerapi.BodyKind
+		body     string
+		options  []handler.Option
+		expected string
+	}{
+		{name: "request", kind: handlerapi.BodyKindRequest, body: body, expected: "unknown"},
+		{name: "empty request", kind: handlerapi.BodyKindRequest, expected: ""},
+		{
+			name:     "request limited",
+			kind:     handlerapi.BodyKindRequest,
+			body:     body,
+			options:  []handler.Option{handler.MaxRequestBuffer(8192)},
+			expected: body,
+		},
+		{
+			name:     "request over limit",
+			kind:     handlerapi.BodyKindRequest,
+			body:     body,
+			options:  []handler.Option{handler.MaxRequestBuffer(1024)},
+			expected: "unknown",
+		},
+		{
+			name:     "request under spill threshold",
+			kind:     handlerapi.BodyKindRequest,
+			body:     body,
+			options:  []handler.Option{handler.SpillToDisk(8192, t.TempDir())},
+			expected: body,
+		},
+		{
+			name:     "request limited under spill threshold",
+			kind:     handlerapi.BodyKindRequest,
+			body:     body,
+			options:  []handler.Option{handler.MaxRequestBuffer(8192), handler.SpillToDisk(8192, t.TempDir())},
+			expected: body,
+		},
+		{
+			name:     "request may spill",
+			kind:     handlerapi.BodyKindRequest,
+			body:     body,
+			options:  []handler.Option{handler.SpillToDisk(1024, t.TempDir())},
+			expected: "unknown",
+		},
+		{name: "response", kind: handlerapi.BodyKindResponse, body: body, expected: body},
+		{
+			name:     "response spilled",
+			kind:     handlerapi.BodyKindResponse,
+			body:     body,
+			options:  []handler.Option{handler.SpillToDisk(1024, t.TempDir())},
+			expected: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			guestConfig := make([]byte, 4)
+			binary.LittleEndian.PutUint32(guestConfig, uint32(tc.kind))
+			options := append([]handler.Option{handler.GuestConfig(guestConfig)}, tc.options...)
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EBodyLen, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tc.body)) // nolint
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			content, _ := io.ReadAll(resp.Body)
+			if want, have := tc.expected, string(content); want != have {
+				t.Fatalf("unexpected response body, want %d bytes, have %d: %q", len(want), len(have), have)
+			}
+		})
+	}
+}
+
+// TestReplaceBody uses test.BinE2EReplaceBody which replaces a pattern in a
+// body on the host, and returns the count as a response header.
+func TestReplaceBody(t *testing.T) {
+	body := "hello open sesame world, open sesame"
+
+	tests := []struct {
+		name                 string
+		kind                 handlerapi.BodyKind
+		flags                handlerapi.ReplaceFlags
+		pattern, replacement string
+		expectedBody         string
+		expectedCount        string
+	}{
+		{
+			name:          "request",
+			kind:          handlerapi.BodyKindRequest,
+			pattern:       "sesame",
+			replacement:   "######",
+			expectedBody:  "hello open ###### world, open ######",
+			expectedCount: "2",
+		},
+		{
+			name:          "request no match",
+			kind:          handlerapi.BodyKindRequest,
+			pattern:       "sesame street",
+			replacement:   "#",
+			expectedBody:  body,
+			expectedCount: "0",
+		},
+		{
+			name:          "request regexp",
+			kind:          handlerapi.BodyKindRequest,
+			flags:         handlerapi.ReplaceFlagRegexp,
+			pattern:       `open (\w+)`,
+			replacement:   "closed ${1}",
+			expectedBody:  "hello closed sesame world, closed sesame",
+			expectedCount: "2",
+		},
+		{
+			name:          "response",
+			kind:          handlerapi.BodyKindResponse,
+			pattern:       "open ",
+			expectedBody:  "hello sesame world, sesame",
+			expectedCount: "2",
+		},
+		{
+			name:          "response regexp",
+			kind:          handlerapi.BodyKindResponse,
+			flags:         handlerapi.ReplaceFlagRegexp,
+			pattern:       `^hello`,
+			replacement:   "goodbye",
+			expectedBody:  "goodbye open sesame world, open sesame",
+			expectedCount: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			guestConfig := []byte{byte(tc.kind), byte(tc.flags), byte(len(tc.pattern))}
+			guestConfig = append(guestConfig, tc.pattern+tc.replacement...)
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EReplaceBody, handler.GuestConfig(guestConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(w, r.Body) // nolint
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			content, _ := io.ReadAll(resp.Body)
+			if want, have := tc.expectedBody, string(content); want != have {
+				t.Fatalf("unexpected body, want: %q, have: %q", want, have)
+			}
+			if want, have := tc.expectedCount, resp.Header.Get("X-Replacements"); want != have {
+				t.Fatalf("unexpected count, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// TestBodyRewritePolicy ensures headers are reconciled with bodies the guest
+// overwrites, according to handler.BodyRewritePolicy.
+func TestBodyRewritePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []handler.Option
+		fixed   bool
+	}{
+		{name: "default", fixed: true},
+		{name: "disabled", options: []handler.Option{handler.BodyRewritePolicy(0)}},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name+" request", func(t *testing.T) {
+			// test.BinE2EQuery overwrites the request body with "chip".
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EQuery, tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			var nextReq *http.Request
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextReq = r
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+"?name=chip", strings.NewReader("original body"))
+			req.Header.Set("Content-MD5", "9qmmAh+m5G6Qk7Lh6+dz8Q==")
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			wantLength, wantMD5 := int64(13), "9qmmAh+m5G6Qk7Lh6+dz8Q=="
+			if tc.fixed {
+				wantLength, wantMD5 = 4, ""
+			}
+			if have := nextReq.ContentLength; wantLength != have {
+				t.Fatalf("unexpected content length, want: %d, have: %d", wantLength, have)
+			}
+			if want, have := strconv.FormatInt(wantLength, 10), nextReq.Header.Get("Content-Length"); tc.fixed && want != have {
+				t.Fatalf("unexpected Content-Length, want: %q, have: %q", want, have)
+			}
+			if have := nextReq.Header.Get("Content-MD5"); wantMD5 != have {
+				t.Fatalf("unexpected Content-MD5, want: %q, have: %q", wantMD5, have)
+			}
+		})
+
+		t.Run(tc.name+" response", func(t *testing.T) {
+			// test.BinExampleRedact overwrites a response body containing
+			// the secret.
+			options := append([]handler.Option{handler.GuestConfig([]byte("open sesame"))}, tc.options...)
+			mw, err := wasm.NewMiddleware(testCtx, test.BinExampleRedact, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				w.Write([]byte("open sesame")) // nolint
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			wantETag := `"v1"`
+			if tc.fixed {
+				wantETag = ""
+				if want, have := "11", resp.Header.Get("Content-Length"); want != have {
+					t.Fatalf("unexpected Content-Length, want: %q, have: %q", want, have)
+				}
+			}
+			if have := resp.Header.Get("ETag"); wantETag != have {
+				t.Fatalf("unexpected ETag, want: %q, have: %q", wantETag, have)
+			}
+		})
+	}
+}
+
+// TestHandleResponse uses test.BinE2EHandleResponse which ensures reqCtx
+// propagates from handler.FuncHandleRequest to handler.FuncHandleResponse.
+func TestHandleResponse(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EHandleResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, noopHandler))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("invalid status code: %d, status message: %s", resp.StatusCode, resp.Status)
+	}
+}
+
+// TestConn uses test.BinE2EConn which writes the remote address and TLS
+// version to the response body.
+func TestConn(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	var remoteAddr string
+	ts := httptest.NewUnstartedServer(mw.NewHandler(testCtx, noopHandler))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			remoteAddr = conn.RemoteAddr().String()
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := remoteAddr+"|TLS 1.3", string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+}
+
+// TestDecodeContent ensures handler.FeatureDecodeContent lets the guest read
+// and write encoded bodies as their content.
+func TestDecodeContent(t *testing.T) {
+	tests := []struct {
+		name, coding string
+		encode       func(io.Writer) io.WriteCloser
+	}{
+		{name: "gzip", coding: "gzip", encode: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{name: "deflate", coding: "deflate", encode: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{name: "identity"},
+	}
+
+	// encode uses t.Error, as the next handler calls it on the server
+	// goroutine.
+	encode := func(t *testing.T, encode func(io.Writer) io.WriteCloser, content string) []byte {
+		if encode == nil {
+			return []byte(content)
+		}
+		var b bytes.Buffer
+		w := encode(&b)
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Error(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
+		return b.Bytes()
+	}
+
+	decode := func(t *testing.T, coding string, body []byte) string {
+		var r io.Reader = bytes.NewReader(body)
+		var err error
+		switch coding {
+		case "gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			r, err = zlib.NewReader(r)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	features := handlerapi.FeatureBufferRequest | handlerapi.FeatureBufferResponse | handlerapi.FeatureDecodeContent
+	guestConfig := make([]byte, 4)
+	binary.LittleEndian.PutUint32(guestConfig, uint32(features))
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EDecodeContent, handler.GuestConfig(guestConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			var nextBody, nextEncoding string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				nextBody, nextEncoding = string(b), r.Header.Get("Content-Encoding")
+
+				if tc.coding != "" {
+					w.Header().Set("Content-Encoding", tc.coding)
+				}
+				w.Write(encode(t, tc.encode, "hello world")) // nolint
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(encode(t, tc.encode, "request content")))
+			if tc.coding != "" {
+				req.Header.Set("Content-Encoding", tc.coding)
+			}
+			req.Header.Set("Accept-Encoding", "gzip, deflate") // don't decompress
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			// The guest wrote the request body it decoded.
+			if want, have := "request content", nextBody; want != have {
+				t.Fatalf("unexpected request body, want: %q, have: %q", want, have)
+			}
+			if want, have := "", nextEncoding; want != have {
+				t.Fatalf("unexpected request Content-Encoding, want: %q, have: %q", want, have)
+			}
+
+			// The guest wrote the response body it decoded, which was encoded
+			// again.
+			if want, have := tc.coding, resp.Header.Get("Content-Encoding"); want != have {
+				t.Fatalf("unexpected response Content-Encoding, want: %q, have: %q", want, have)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := "HELLO WORLD", decode(t, tc.coding, body); want != have {
+				t.Fatalf("unexpected response content, want: %q, have: %q", want, have)
+			}
+			if want, have := strconv.Itoa(len(body)), resp.Header.Get("Content-Length"); want != have {
+				t.Fatalf("unexpected Content-Length, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// TestTrailers ensures the guest can read request trailers and add response
+// trailers, over HTTP/1.1 chunked encoding and HTTP/2.
+func TestTrailers(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2ETrailers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	var nextTrailer http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// This runs on the server goroutine, where t.Fatal can't stop the test.
+		if _, err := io.ReadAll(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		nextTrailer = r.Trailer
+		// Trailers can't be sent with a Content-Length on HTTP/1.1, so the
+		// host needs to remove it.
+		w.Header().Set("Content-Length", "5")
+		w.Write([]byte("hello")) // nolint
+	})
+
+	tests := []struct {
+		http2    bool
+		expected string
+	}{
+		{
+			http2:    false,
+			expected: "HTTP/1.1",
+		},
+		{
+			http2:    true,
+			expected: "HTTP/2.0",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.expected, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(mw.NewHandler(testCtx, next))
+			if tc.http2 {
+				ts.EnableHTTP2 = true
+				ts.StartTLS()
+			} else {
+				ts.Start()
+			}
+			defer ts.Close()
+
+			// An unknown length ensures chunked encoding on HTTP/1.1.
+			req, _ := http.NewRequest(http.MethodPost, ts.URL, io.NopCloser(strings.NewReader("request")))
+			req.ContentLength = -1
+			req.Trailer = http.Header{"X-Checksum": {"a", "b"}}
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := tc.expected, resp.Proto; want != have {
+				t.Fatalf("unexpected protocol, want: %q, have: %q", want, have)
+			}
+			body, err := io.ReadAll(resp.Body) // trailers are read after the body
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := "hello", string(body); want != have {
+				t.Fatalf("unexpected body, want: %q, have: %q", want, have)
+			}
+			if want, have := []string{"a", "b"}, nextTrailer.Values("X-Checksum"); !reflect.DeepEqual(want, have) {
+				t.Fatalf("unexpected request trailer, want: %v, have: %v", want, have)
+			}
+			if want, have := []string{"a", "b"}, resp.Trailer.Values("X-Checksum-Echo"); !reflect.DeepEqual(want, have) {
+				t.Fatalf("unexpected response trailer, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
+// TestStreamTrailers ensures the guest can set response trailers after the
+// headers were sent while streaming.
+func TestStreamTrailers(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EStreamTrailers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello")) // nolint
+		w.(http.Flusher).Flush()
+		w.Write([]byte(" world")) // nolint
+	})
+
+	for _, http2 := range []bool{false, true} {
+		ts := httptest.NewUnstartedServer(mw.NewHandler(testCtx, next))
+		if http2 {
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+		} else {
+			ts.Start()
+		}
+
+		resp, err := ts.Client().Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, have := "hello world", string(body); want != have {
+			t.Fatalf("%s: unexpected body, want: %q, have: %q", resp.Proto, want, have)
+		}
+		if want, have := "2", resp.Trailer.Get("X-Chunks"); want != have {
+			t.Fatalf("%s: unexpected trailer, want: %q, have: %q", resp.Proto, want, have)
+		}
+	}
+}
+
+// TestResponseController ensures optional interfaces of the response writer
+// work through the middleware, or fail clearly when buffering.
+func TestResponseController(t *testing.T) {
+	bufferResponse := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bufferResponse, uint32(handlerapi.FeatureBufferResponse))
+
+	tests := []struct {
+		name          string
+		guest         []byte
+		guestConfig   []byte
+		wantFlushErr  bool
+		wantHijackErr bool
+	}{
+		{name: "pass-through", guest: test.BinE2EHeaderValue},
+		{name: "streaming", guest: test.BinE2EStreamResponse},
+		{
+			name:          "buffering",
+			guest:         test.BinE2EDecodeContent,
+			guestConfig:   bufferResponse,
+			wantFlushErr:  true,
+			wantHijackErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := wasm.NewMiddleware(testCtx, tc.guest, handler.GuestConfig(tc.guestConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			var deadlineErr, flushErr, hijackErr error
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rc := http.NewResponseController(w)
+				deadlineErr = rc.SetWriteDeadline(time.Now().Add(time.Minute))
+				if _, hijack := r.URL.Query()["hijack"]; !hijack {
+					w.Write([]byte("ok")) // nolint
+					flushErr = rc.Flush()
+					return
+				}
+
+				conn, brw, err := rc.Hijack()
+				if hijackErr = err; err != nil {
+					return
+				}
+				defer conn.Close()
+				brw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok") // nolint
+				brw.Flush()                                                                            // nolint
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			for _, url := range []string{ts.URL, ts.URL + "?hijack"} {
+				resp, err := ts.Client().Get(url)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+
+			if deadlineErr != nil {
+				t.Errorf("unexpected deadline error: %v", deadlineErr)
+			}
+			if want, have := tc.wantFlushErr, flushErr != nil; want != have {
+				t.Errorf("unexpected flush error: %v", flushErr)
+			} else if have && !errors.Is(flushErr, http.ErrNotSupported) {
+				t.Errorf("unexpected flush error: %v", flushErr)
+			}
+			if want, have := tc.wantHijackErr, hijackErr != nil; want != have {
+				t.Errorf("unexpected hijack error: %v", hijackErr)
+			} else if have && !errors.Is(hijackErr, http.ErrNotSupported) {
+				t.Errorf("unexpected hijack error: %v", hijackErr)
+			}
+		})
+	}
+}
+
+// TestOptionalInterfaces ensures the next handler sees the same optional
+// interfaces as the response writer the host was given, such as
+// http.Pusher on HTTP/2.
+func TestOptionalInterfaces(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EHeaderValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	type interfaces struct {
+		flusher, hijacker, readerFrom, pusher, stringWriter bool
+	}
+	interfacesOf := func(w http.ResponseWriter) (i interfaces) {
+		_, i.flusher = w.(http.Flusher)
+		_, i.hijacker = w.(http.Hijacker)
+		_, i.readerFrom = w.(io.ReaderFrom)
+		_, i.pusher = w.(http.Pusher)
+		_, i.stringWriter = w.(io.StringWriter)
+		return
+	}
+
+	var given, next interfaces
+	var pushErr error
+	h := mw.NewHandler(testCtx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next = interfacesOf(w)
+		if p, ok := w.(http.Pusher); ok {
+			pushErr = p.Push("/style.css", nil)
+		}
+	}))
+
+	for _, http2 := range []bool{false, true} {
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given = interfacesOf(w)
+			h.ServeHTTP(w, r)
+		}))
+		if http2 {
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+		} else {
+			ts.Start()
+		}
+
+		resp, err := ts.Client().Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		ts.Close()
+
+		if given != next {
+			t.Errorf("unexpected interfaces (http2: %v), want: %+v, have: %+v", http2, given, next)
+		}
+		if http2 && !next.pusher {
+			t.Error("expected http.Pusher on HTTP/2")
+		}
+	}
+
+	// The client doesn't enable push, so the delegate's error shows Push
+	// reached it.
+	if !errors.Is(pushErr, http.ErrNotSupported) {
+		t.Errorf("unexpected push error: %v", pushErr)
+	}
+}
+
+// recordingLogger records messages logged by the guest.
+type recordingLogger struct {
+	messages []string
+}
+
+// IsEnabled implements the same method as documented on api.Logger.
+func (l *recordingLogger) IsEnabled(api.LogLevel) bool {
+	return true
+}
+
+// Log implements the same method as documented on api.Logger.
+func (l *recordingLogger) Log(_ context.Context, _ api.LogLevel, message string) {
+	l.messages = append(l.messages, message)
+}
+
+// TestUpgrade ensures the guest can approve or reject a protocol upgrade,
+// which isn't buffered, and sees the 101 status when approved.
+func TestUpgrade(t *testing.T) {
+	echo := func(t *testing.T, conn net.Conn, brw *bufio.ReadWriter) {
+		defer conn.Close()
+		line, err := brw.ReadString('\n')
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		brw.WriteString(line) // nolint
+		brw.Flush()           // nolint
+	}
+
+	tests := []struct {
+		name        string
+		upgrade     string
+		next        http.HandlerFunc
+		wantStatus  int
+		wantLog     []string
+		wantEchoed  bool
+		wantNextRan bool
+	}{
+		{
+			name:    "hijack writes 101",
+			upgrade: "websocket",
+			next: func(w http.ResponseWriter, r *http.Request) {
+				conn, brw, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n") // nolint
+				brw.Flush()                                                                                              // nolint
+				echo(t, conn, brw)
+			},
+			wantStatus: http.StatusSwitchingProtocols,
+			wantLog:    []string{"0", "101"},
+			wantEchoed: true,
+		},
+		{
+			name:    "WriteHeader 101 then hijack",
+			upgrade: "websocket",
+			next: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Upgrade", "websocket")
+				w.Header().Set("Connection", "Upgrade")
+				w.WriteHeader(http.StatusSwitchingProtocols)
+				conn, brw, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				echo(t, conn, brw)
+			},
+			wantStatus: http.StatusSwitchingProtocols,
+			wantLog:    []string{"0", "101"},
+			wantEchoed: true,
+		},
+		{
+			name:       "rejected",
+			upgrade:    "h2c",
+			next:       func(w http.ResponseWriter, r *http.Request) { t.Error("next handler called") },
+			wantStatus: http.StatusForbidden,
+			wantLog:    []string{"0"},
+		},
+		{
+			name:       "not an upgrade",
+			next:       func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+			wantLog:    []string{"3", "200"}, // buffering is enabled
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &recordingLogger{}
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EUpgrade, handler.Logger(logger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			// Hijacked connections aren't tracked by the server, so signal when
+			// the handler completed instead.
+			h, served := mw.NewHandler(testCtx, tc.next), make(chan struct{})
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(served)
+				h.ServeHTTP(w, r)
+			}))
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+			if tc.upgrade != "" {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", tc.upgrade)
+			}
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := tc.wantStatus, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if tc.wantEchoed {
+				conn := resp.Body.(io.ReadWriteCloser)
+				if _, err = conn.Write([]byte("ping\n")); err != nil {
+					t.Fatal(err)
+				}
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, have := "ping\n", line; want != have {
+					t.Fatalf("unexpected echo, want: %q, have: %q", want, have)
+				}
+			}
+
+			<-served
+			if want, have := tc.wantLog, logger.messages; !reflect.DeepEqual(want, have) {
+				t.Fatalf("unexpected log, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
+func TestEarlyHints(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EEarlyHints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello")) // nolint
+	})
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	var informational []int
+	var links []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			links = append(links, header.Values("Link")...)
+			return nil
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if want, have := []int{http.StatusEarlyHints}, informational; !reflect.DeepEqual(want, have) {
+		t.Fatalf("unexpected informational status codes, want: %v, have: %v", want, have)
+	}
+	if want, have := []string{"</style.css>; rel=preload; as=style"}, links; !reflect.DeepEqual(want, have) {
+		t.Fatalf("unexpected early hints, want: %v, have: %v", want, have)
+	}
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+}
+
+// TestStatusCode ensures the guest reads the status code written by the next
+// handler without buffering, and can't set an invalid one.
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode uint32
+		reason     string
+		next       http.HandlerFunc
+		wantStatus int
+		wantBody   string
+		wantLog    []string
+	}{
+		{
+			name:       "next writes status",
+			next:       func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) },
+			wantStatus: http.StatusNotFound,
+			wantLog:    []string{"404"},
+		},
+		{
+			name:       "next writes body",
+			next:       func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) }, // nolint
+			wantStatus: http.StatusOK,
+			wantBody:   "hello",
+			wantLog:    []string{"200"},
+		},
+		{
+			name: "next writes early hints",
+			next: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusCreated)
+			},
+			wantStatus: http.StatusCreated,
+			wantLog:    []string{"201"},
+		},
+		{
+			name:       "guest sets status",
+			statusCode: http.StatusTeapot,
+			wantStatus: http.StatusTeapot,
+		},
+		{
+			name:       "guest sets invalid status",
+			statusCode: 1000,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "invalid status code: 1000",
+		},
+		{
+			name:       "reason phrase unsupported",
+			statusCode: http.StatusOK,
+			reason:     "Fine",
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "host doesn't support reason phrases",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			config := binary.LittleEndian.AppendUint32(nil, tc.statusCode)
+			config = append(config, tc.reason...)
+			logger := &recordingLogger{}
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EStatusCode,
+				handler.GuestConfig(config), handler.Logger(logger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			next := tc.next
+			if next == nil {
+				next = func(w http.ResponseWriter, r *http.Request) { t.Error("next handler called") }
+			}
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := tc.wantStatus, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), tc.wantBody) {
+				t.Fatalf("unexpected body, want: %q, have: %q", tc.wantBody, body)
+			}
+
+			ts.Close() // wait for the handler to complete.
+			if want, have := tc.wantLog, logger.messages; !reflect.DeepEqual(want, have) {
+				t.Fatalf("unexpected log, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
+// TestSendResponse ensures the guest can send a local reply at once, and that
+// nothing is sent when it is invalid.
+func TestSendResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       byte
+		wantStatus int
+		wantHeader http.Header
+		wantBody   string
+	}{
+		{
+			name:       "sent",
+			wantStatus: http.StatusUnauthorized,
+			wantHeader: http.Header{
+				"Www-Authenticate": {`Basic realm="test"`},
+				"Content-Type":     {"text/plain"},
+			},
+			wantBody: "unauthorized",
+		},
+		{
+			name:       "invalid headers",
+			mode:       2,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "header block must be NUL-terminated",
+		},
+		{
+			// Without buffering, setting the status code sends it.
+			name:       "after headers were sent",
+			mode:       4,
+			wantStatus: http.StatusAccepted,
+			wantBody:   "can't call send_response after the response headers were sent",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2ESendResponse, handler.GuestConfig([]byte{tc.mode}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { t.Error("next handler called") })
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := tc.wantStatus, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			for name, want := range tc.wantHeader {
+				if have := resp.Header.Values(name); !reflect.DeepEqual(want, have) {
+					t.Fatalf("unexpected %s, want: %v, have: %v", name, want, have)
+				}
+			}
+			if tc.wantHeader == nil && resp.Header.Get("Www-Authenticate") != "" {
+				t.Fatal("expected no partial response")
+			}
+			if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), tc.wantBody) {
+				t.Fatalf("unexpected body, want: %q, have: %q", tc.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestCopyHeaders ensures headers read in one call can be set in another,
+// including multiple values.
+func TestCopyHeaders(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2ECopyHeaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Accept", "application/json") // added after the copy
+	})
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept", "*/*")
+	req.Header.Set("X-Empty", "")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if want, have := []string{"text/html", "*/*", "application/json"}, resp.Header.Values("Accept"); !reflect.DeepEqual(want, have) {
+		t.Fatalf("unexpected Accept, want: %v, have: %v", want, have)
+	}
+	if want, have := []string{""}, resp.Header.Values("X-Empty"); !reflect.DeepEqual(want, have) {
+		t.Fatalf("unexpected X-Empty, want: %v, have: %v", want, have)
 	}
 }
@@ -0,0 +1,72 @@
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spillBuffer is an append-only buffer which keeps up to threshold bytes in
+// memory and the rest in a temporary file. A zero threshold keeps everything
+// in memory.
+type spillBuffer struct {
+	threshold int64
+	dir       string
+
+	mem     []byte
+	file    *os.File
+	fileLen int64
+}
+
+// Len returns the count of bytes written since the last Reset.
+func (b *spillBuffer) Len() int64 {
+	return int64(len(b.mem)) + b.fileLen
+}
+
+// Write implements io.Writer, spilling to a temporary file once the
+// threshold is reached.
+func (b *spillBuffer) Write(p []byte) (n int, err error) {
+	if b.file == nil {
+		if b.threshold <= 0 || int64(len(b.mem)+len(p)) <= b.threshold {
+			b.mem = append(b.mem, p...)
+			return len(p), nil
+		}
+
+		inMem := int(b.threshold) - len(b.mem)
+		b.mem = append(b.mem, p[:inMem]...)
+		n, p = inMem, p[inMem:]
+
+		if b.file, err = os.CreateTemp(b.dir, "http-wasm-body-*"); err != nil {
+			return n, fmt.Errorf("error spilling body to disk: %w", err)
+		}
+	}
+
+	written, err := b.file.Write(p)
+	b.fileLen += int64(written)
+	return n + written, err
+}
+
+// Reader returns a reader of everything written since the last Reset.
+func (b *spillBuffer) Reader() io.Reader {
+	if b.file == nil {
+		return bytes.NewReader(b.mem)
+	}
+	return io.MultiReader(bytes.NewReader(b.mem), io.NewSectionReader(b.file, 0, b.fileLen))
+}
+
+// Reset discards everything written, removing any temporary file.
+//
+// Note: This drops the memory rather than truncating it, as readers of what
+// was written may still reference it.
+func (b *spillBuffer) Reset() (err error) {
+	b.mem = nil
+	if f := b.file; f != nil {
+		b.file, b.fileLen = nil, 0
+		err = f.Close()
+		if removeErr := os.Remove(f.Name()); err == nil {
+			err = removeErr
+		}
+	}
+	return
+}
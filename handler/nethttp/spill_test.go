@@ -0,0 +1,88 @@
+package wasm
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func Test_spillBuffer(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int64
+		writes    []string
+		spilled   bool
+	}{
+		{
+			name:   "zero threshold",
+			writes: []string{"hello ", "world"},
+		},
+		{
+			name:      "under threshold",
+			threshold: 11,
+			writes:    []string{"hello ", "world"},
+		},
+		{
+			name:      "spills within a write",
+			threshold: 8,
+			writes:    []string{"hello ", "world"},
+			spilled:   true,
+		},
+		{
+			name:      "spills on a write boundary",
+			threshold: 6,
+			writes:    []string{"hello ", "world"},
+			spilled:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			b := &spillBuffer{threshold: tc.threshold, dir: dir}
+
+			for _, w := range tc.writes {
+				if n, err := b.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				} else if n != len(w) {
+					t.Fatalf("unexpected write count, want: %d, have: %d", len(w), n)
+				}
+			}
+
+			if want, have := int64(11), b.Len(); want != have {
+				t.Fatalf("unexpected length, want: %d, have: %d", want, have)
+			}
+			requireFileCount(t, dir, tc.spilled)
+
+			// Read twice to ensure reads don't consume the buffer.
+			for i := 0; i < 2; i++ {
+				body, err := io.ReadAll(b.Reader())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, have := "hello world", string(body); want != have {
+					t.Fatalf("unexpected body, want: %q, have: %q", want, have)
+				}
+			}
+
+			if err := b.Reset(); err != nil {
+				t.Fatal(err)
+			}
+			if want, have := int64(0), b.Len(); want != have {
+				t.Fatalf("unexpected length, want: %d, have: %d", want, have)
+			}
+			requireFileCount(t, dir, false)
+		})
+	}
+}
+
+func requireFileCount(t *testing.T, dir string, spilled bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spilled != (len(entries) == 1) || len(entries) > 1 {
+		t.Fatalf("unexpected temporary files, spilled: %v, have: %d", spilled, len(entries))
+	}
+}
@@ -0,0 +1,239 @@
+package wasm
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// recordingResponseWriter is the response writer the host was given. It
+// passes the response through, recording its status code for the guest when
+// it isn't otherwise observable, for example after the next handler wrote a
+// response that isn't buffered.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode uint32
+
+	// upgrade is true when the request asks to upgrade the connection, so
+	// hijacking it implies the status code 101.
+	upgrade bool
+}
+
+// WriteHeader records the final status code and dispatches to the delegate.
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 && !isInformational(statusCode) {
+		w.statusCode = uint32(statusCode)
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the implicit status code and dispatches to the delegate.
+func (w *recordingResponseWriter) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// WriteString records the implicit status code and dispatches to the
+// delegate, which avoids copying the string if it implements io.StringWriter.
+func (w *recordingResponseWriter) WriteString(p string) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return io.WriteString(w.ResponseWriter, p)
+}
+
+// Unwrap returns the delegate, so that http.ResponseController can control
+// it, for example to set deadlines.
+func (w *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// recorderFeatures are the optional interfaces of the delegate a recorder
+// implements, so that handlers detecting them see what the host was given.
+type recorderFeatures uint8
+
+const (
+	recorderFlusher recorderFeatures = 1 << iota
+	recorderHijacker
+	recorderReaderFrom
+	recorderPusher
+)
+
+// recorderFeaturesOf returns the optional interfaces w implements.
+func recorderFeaturesOf(w http.ResponseWriter) (f recorderFeatures) {
+	if _, ok := w.(http.Flusher); ok {
+		f |= recorderFlusher
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		f |= recorderHijacker
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		f |= recorderReaderFrom
+	}
+	if _, ok := w.(http.Pusher); ok {
+		f |= recorderPusher
+	}
+	return
+}
+
+// wrap returns the recorder as a response writer implementing only the
+// optional interfaces in features.
+func (w *recordingResponseWriter) wrap(f recorderFeatures) http.ResponseWriter {
+	fl, hj, rf, pu := recordingFlusher{w}, recordingHijacker{w}, recordingReaderFrom{w}, recordingPusher{w}
+	switch f {
+	case recorderFlusher:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+		}{w, fl}
+	case recorderHijacker:
+		return struct {
+			*recordingResponseWriter
+			recordingHijacker
+		}{w, hj}
+	case recorderFlusher | recorderHijacker:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+			recordingHijacker
+		}{w, fl, hj}
+	case recorderReaderFrom:
+		return struct {
+			*recordingResponseWriter
+			recordingReaderFrom
+		}{w, rf}
+	case recorderFlusher | recorderReaderFrom:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+			recordingReaderFrom
+		}{w, fl, rf}
+	case recorderHijacker | recorderReaderFrom:
+		return struct {
+			*recordingResponseWriter
+			recordingHijacker
+			recordingReaderFrom
+		}{w, hj, rf}
+	case recorderFlusher | recorderHijacker | recorderReaderFrom:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+			recordingHijacker
+			recordingReaderFrom
+		}{w, fl, hj, rf}
+	case recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingPusher
+		}{w, pu}
+	case recorderFlusher | recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+			recordingPusher
+		}{w, fl, pu}
+	case recorderHijacker | recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingHijacker
+			recordingPusher
+		}{w, hj, pu}
+	case recorderFlusher | recorderHijacker | recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+			recordingHijacker
+			recordingPusher
+		}{w, fl, hj, pu}
+	case recorderReaderFrom | recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingReaderFrom
+			recordingPusher
+		}{w, rf, pu}
+	case recorderFlusher | recorderReaderFrom | recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+			recordingReaderFrom
+			recordingPusher
+		}{w, fl, rf, pu}
+	case recorderHijacker | recorderReaderFrom | recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingHijacker
+			recordingReaderFrom
+			recordingPusher
+		}{w, hj, rf, pu}
+	case recorderFlusher | recorderHijacker | recorderReaderFrom | recorderPusher:
+		return struct {
+			*recordingResponseWriter
+			recordingFlusher
+			recordingHijacker
+			recordingReaderFrom
+			recordingPusher
+		}{w, fl, hj, rf, pu}
+	}
+	return w
+}
+
+// recordingFlusher implements http.Flusher for a recorder.
+type recordingFlusher struct{ w *recordingResponseWriter }
+
+// Flush implements http.Flusher by calling FlushError.
+func (f recordingFlusher) Flush() {
+	_ = f.FlushError()
+}
+
+// FlushError flushes the delegate, returning an error if it doesn't support
+// that.
+func (f recordingFlusher) FlushError() error {
+	if f.w.statusCode == 0 {
+		f.w.statusCode = http.StatusOK
+	}
+	return http.NewResponseController(f.w.ResponseWriter).Flush()
+}
+
+// recordingHijacker implements http.Hijacker for a recorder.
+type recordingHijacker struct{ w *recordingResponseWriter }
+
+// Hijack hijacks the delegate. Handlers such as WebSocket libraries write
+// the 101 response to the connection, so that's the status code recorded
+// for upgrade requests.
+func (h recordingHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(h.w.ResponseWriter).Hijack()
+	if err == nil && h.w.statusCode == 0 && h.w.upgrade {
+		h.w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// recordingReaderFrom implements io.ReaderFrom for a recorder.
+type recordingReaderFrom struct{ w *recordingResponseWriter }
+
+// ReadFrom records the implicit status code and copies to the delegate, so
+// that it can still use optimizations such as sendfile.
+func (r recordingReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	if r.w.statusCode == 0 {
+		r.w.statusCode = http.StatusOK
+	}
+	return r.w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+}
+
+// recordingPusher implements http.Pusher for a recorder.
+type recordingPusher struct{ w *recordingResponseWriter }
+
+// Push dispatches to the delegate.
+func (p recordingPusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// isInformational returns true if the status code is an interim response
+// sent before the final one, such as 103 Early Hints. 101 is excluded, as no
+// response follows it.
+func isInformational(statusCode int) bool {
+	return statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols
+}
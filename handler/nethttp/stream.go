@@ -0,0 +1,298 @@
+package wasm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/httpwasm/http-wasm-host-go/handler"
+)
+
+// streamingResponseWriter calls the guest for each chunk of the response body
+// written by the next handler, when handler.FeatureStreamResponse is enabled.
+type streamingResponseWriter struct {
+	delegate   http.ResponseWriter
+	statusCode uint32
+
+	// policy reconciles headers before they are sent, if the guest wrote the
+	// body by then.
+	policy handler.RewritePolicy
+
+	// handleBody calls handler.FuncHandleResponseBody on the guest.
+	handleBody func(endOfStream bool) error
+
+	// chunk is the body written by the next handler the guest is handling.
+	chunk []byte
+
+	// wroteChunk is true when the guest wrote the body, so chunk should not
+	// be sent.
+	wroteChunk bool
+
+	// request is the request being responded to, which determines if the
+	// response can have trailers.
+	request *http.Request
+
+	// sentHeader is true once the status code and headers were sent.
+	sentHeader bool
+
+	// trailersSendable is true if trailers can still be sent after the
+	// headers, for example with chunked encoding.
+	trailersSendable bool
+
+	// err is any error from the guest, which fails subsequent writes.
+	err error
+
+	// hijacked is true once the next handler took over the connection, so
+	// nothing more can be sent.
+	hijacked bool
+}
+
+// Header dispatches to the delegate.
+func (w *streamingResponseWriter) Header() http.Header {
+	return w.delegate.Header()
+}
+
+// Write calls the guest with the chunk, then sends it unless the guest wrote
+// the body instead.
+func (w *streamingResponseWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, w.err
+	}
+	if err := w.handleChunk(p, false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteHeader defers the status code until the first chunk was handled.
+// Informational responses, such as 103 Early Hints, are sent immediately.
+func (w *streamingResponseWriter) WriteHeader(statusCode int) {
+	if w.sentHeader {
+		return
+	} else if isInformational(statusCode) {
+		w.delegate.WriteHeader(statusCode)
+		return
+	}
+	w.statusCode = uint32(statusCode)
+}
+
+// Flush implements http.Flusher by calling FlushError.
+func (w *streamingResponseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// FlushError sends the status code and headers, then flushes the delegate,
+// returning an error if it doesn't support that.
+func (w *streamingResponseWriter) FlushError() error {
+	if w.hijacked {
+		return http.ErrHijacked
+	}
+	w.sendHeader()
+	return http.NewResponseController(w.delegate).Flush()
+}
+
+// Hijack hijacks the delegate, after which the guest isn't called for the
+// end of the body, as nothing more can be sent.
+func (w *streamingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.delegate).Hijack()
+	if err == nil {
+		w.hijacked, w.sentHeader = true, true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the delegate, so that http.ResponseController can control
+// it, for example to set deadlines.
+func (w *streamingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.delegate
+}
+
+func (w *streamingResponseWriter) handleChunk(p []byte, endOfStream bool) (err error) {
+	if w.err != nil {
+		return w.err
+	} else if w.hijacked {
+		return http.ErrHijacked
+	}
+
+	w.chunk, w.wroteChunk = p, false
+	err = w.handleBody(endOfStream)
+	w.chunk = nil
+	if err != nil {
+		w.err = err
+		return
+	}
+
+	w.sendHeader()
+	if !w.wroteChunk && len(p) > 0 {
+		_, err = w.delegate.Write(p)
+	}
+	return
+}
+
+// sendHeader sends the status code and headers, reconciling them if the guest
+// wrote the body. Headers of a response passing through are left intact, so a
+// guest that changes a later chunk needs to keep its length.
+func (w *streamingResponseWriter) sendHeader() {
+	if w.sentHeader {
+		return
+	}
+	w.sentHeader = true
+	if w.wroteChunk {
+		fixHeaders(w.delegate.Header(), w.policy, -1)
+	}
+	w.trailersSendable = announceTrailers(w.request, w.status(), w.delegate.Header())
+	if statusCode := w.statusCode; statusCode != 0 {
+		w.delegate.WriteHeader(int(statusCode))
+	}
+}
+
+// status returns the status code to send, which defaults to 200.
+func (w *streamingResponseWriter) status() uint32 {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// release notifies the guest the body ended and sends anything left.
+func (w *streamingResponseWriter) release() error {
+	if w.hijacked {
+		return nil
+	}
+	return w.handleChunk(nil, true)
+}
+
+// bodyWriter returns a writer the guest uses to replace the current chunk.
+func (w *streamingResponseWriter) bodyWriter() *streamingBodyWriter {
+	return (*streamingBodyWriter)(w)
+}
+
+// streamingBodyWriter writes the guest's body to the delegate, instead of the
+// chunk written by the next handler.
+type streamingBodyWriter streamingResponseWriter
+
+// Write implements io.Writer
+func (b *streamingBodyWriter) Write(p []byte) (int, error) {
+	w := (*streamingResponseWriter)(b)
+	w.wroteChunk = true
+	w.sendHeader()
+	return w.delegate.Write(p)
+}
+
+// streamingRequestBody calls the guest for each chunk of the request body
+// read by the next handler, when handler.FeatureStreamRequest is enabled.
+//
+// This is pull-based: the delegate is only read when the next handler
+// consumed what the guest produced for the previous chunk. This bounds the
+// memory held to one chunk and what the guest wrote for it.
+type streamingRequestBody struct {
+	delegate io.ReadCloser
+
+	// buf holds each chunk read from the delegate, so its length is
+	// handler.Limits MaxInFlight.
+	buf []byte
+
+	// handleBody calls handler.FuncHandleRequestBody on the guest.
+	handleBody func(endOfStream bool) error
+
+	// chunk is the body read from the delegate the guest is handling.
+	chunk []byte
+
+	// wroteChunk is true when the guest wrote the body, so chunk should not
+	// be read by the next handler.
+	wroteChunk bool
+
+	// out is what the next handler reads: either the guest's body or chunks
+	// passed through.
+	out bytes.Buffer
+
+	// err is returned once out is drained. It is io.EOF at the end.
+	err error
+
+	// guestErr is any error from the guest, also recorded in err.
+	guestErr error
+
+	// mu serializes calls to the guest with those for the response, and
+	// guards detached.
+	mu *sync.Mutex
+
+	// detached is true once the request completed, after which the guest
+	// can't be called, so reads fail.
+	detached bool
+}
+
+// Read implements io.Reader by reading what the guest produced, handling
+// more chunks as needed.
+func (b *streamingRequestBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	detached := b.detached
+	b.mu.Unlock()
+	if detached {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	for b.out.Len() == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.fill()
+	}
+	return b.out.Read(p)
+}
+
+// Close dispatches to the delegate.
+func (b *streamingRequestBody) Close() error {
+	return b.delegate.Close()
+}
+
+// fill handles the next chunk from the delegate, and the end of the stream
+// once reached.
+func (b *streamingRequestBody) fill() {
+	n, err := b.delegate.Read(b.buf)
+	if n > 0 {
+		if b.guestErr = b.handleChunk(b.buf[:n], false); b.guestErr != nil {
+			b.err = b.guestErr
+			return
+		}
+	}
+	if err == io.EOF {
+		if b.guestErr = b.handleChunk(nil, true); b.guestErr != nil {
+			b.err = b.guestErr
+		} else {
+			b.err = io.EOF
+		}
+	} else if err != nil {
+		b.err = err
+	}
+}
+
+// detach prevents calling the guest once the request completed, in case the
+// next handler retained the body.
+func (b *streamingRequestBody) detach() {
+	b.mu.Lock()
+	b.detached = true
+	b.mu.Unlock()
+}
+
+func (b *streamingRequestBody) handleChunk(p []byte, endOfStream bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.detached {
+		return http.ErrBodyReadAfterClose
+	}
+	b.chunk, b.wroteChunk = p, false
+	err := b.handleBody(endOfStream)
+	b.chunk = nil
+	if err == nil && !b.wroteChunk {
+		b.out.Write(p)
+	}
+	return err
+}
+
+// bodyWriter returns a writer the guest uses to replace the current chunk.
+func (b *streamingRequestBody) bodyWriter() io.Writer {
+	b.wroteChunk = true // even writing nothing replaces the chunk.
+	return &b.out
+}
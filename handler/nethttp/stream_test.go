@@ -0,0 +1,58 @@
+package wasm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/httpwasm/http-wasm-host-go/handler"
+)
+
+// Test_streamingResponseWriter_fixHeaders ensures headers are only reconciled
+// when the guest wrote the body.
+func Test_streamingResponseWriter_fixHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		write         bool
+		contentLength string
+		etag          string
+	}{
+		{name: "passes through", contentLength: "11", etag: `"v1"`},
+		{name: "guest wrote", write: true},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/", nil)
+			w := &streamingResponseWriter{
+				delegate: rec,
+				policy:   handler.DefaultRewritePolicy,
+				request:  r,
+			}
+			w.handleBody = func(endOfStream bool) (err error) {
+				if tc.write && !endOfStream {
+					_, err = w.bodyWriter().Write([]byte("HELLO WORLD"))
+				}
+				return
+			}
+
+			w.Header().Set("Content-Length", "11")
+			w.Header().Set("ETag", `"v1"`)
+			if _, err := w.Write([]byte("hello world")); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.release(); err != nil {
+				t.Fatal(err)
+			}
+
+			if want, have := tc.contentLength, rec.Header().Get("Content-Length"); want != have {
+				t.Errorf("unexpected Content-Length, want: %q, have: %q", want, have)
+			}
+			if want, have := tc.etag, rec.Header().Get("ETag"); want != have {
+				t.Errorf("unexpected ETag, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
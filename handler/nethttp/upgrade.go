@@ -0,0 +1,32 @@
+package wasm
+
+import (
+	"net/http"
+	"strings"
+
+	handlerapi "github.com/httpwasm/http-wasm-host-go/api/handler"
+)
+
+// upgradeUnsupported are features disabled for upgrade requests, as the next
+// handler takes over the connection.
+const upgradeUnsupported = handlerapi.FeatureBufferRequest |
+	handlerapi.FeatureBufferResponse |
+	handlerapi.FeatureStreamRequest |
+	handlerapi.FeatureStreamResponse |
+	handlerapi.FeatureDecodeContent
+
+// isUpgradeRequest returns true if the request asks to upgrade the
+// connection to another protocol, such as WebSocket.
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
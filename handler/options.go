@@ -29,7 +29,9 @@ func GuestConfig(guestConfig []byte) Option {
 	}
 }
 
-// ModuleConfig is the configuration used to instantiate the guest.
+// ModuleConfig is the configuration used to instantiate the guest. Defaults
+// to calling "_start" and "_initialize", so both WASI commands and reactors
+// are initialized.
 func ModuleConfig(moduleConfig wazero.ModuleConfig) Option {
 	return func(h *options) {
 		h.moduleConfig = moduleConfig
@@ -44,11 +46,139 @@ func Logger(logger api.Logger) Option {
 	}
 }
 
+// MaxInFlight limits the size in bytes of each chunk of the request body the
+// host reads when handler.FeatureStreamRequest is enabled. The host doesn't
+// read the next chunk until the next handler consumed what the guest wrote
+// for the current one. Defaults to 32KiB.
+func MaxInFlight(maxInFlight int) Option {
+	return func(h *options) {
+		h.limits.MaxInFlight = maxInFlight
+	}
+}
+
+// MaxRequestBuffer limits the size in bytes of the request body the host
+// buffers when handler.FeatureBufferRequest is enabled. Exceeding it fails
+// the request with RequestTooLargeStatus. Defaults to zero, which is
+// unlimited.
+func MaxRequestBuffer(maxRequestBuffer int64) Option {
+	return func(h *options) {
+		h.limits.MaxRequestBuffer = maxRequestBuffer
+	}
+}
+
+// RequestTooLargeStatus is the HTTP status code the host responds with when
+// the request body exceeds MaxRequestBuffer. Defaults to 413.
+func RequestTooLargeStatus(statusCode uint32) Option {
+	return func(h *options) {
+		h.limits.RequestTooLargeStatus = statusCode
+	}
+}
+
+// MaxResponseBuffer limits the size in bytes of the response body the host
+// buffers when handler.FeatureBufferResponse is enabled. Exceeding it passes
+// a handler.BufferLimitError to handler.FuncHandleResponse. Defaults to
+// zero, which is unlimited.
+func MaxResponseBuffer(maxResponseBuffer int64) Option {
+	return func(h *options) {
+		h.limits.MaxResponseBuffer = maxResponseBuffer
+	}
+}
+
+// SpillToDisk keeps at most threshold bytes of a buffered request or response
+// body in memory, writing the rest to a temporary file in dir. The file is
+// removed when the request completes. An empty dir uses os.TempDir. Defaults
+// to a zero threshold, which keeps buffered bodies in memory.
+func SpillToDisk(threshold int64, dir string) Option {
+	return func(h *options) {
+		h.limits.SpillThreshold = threshold
+		h.limits.SpillDir = dir
+	}
+}
+
+// RewritePolicy controls how the host reconciles headers after the guest
+// overwrites a request or response body, for example via
+// handler.FuncWriteBody.
+type RewritePolicy uint32
+
+const (
+	// RewriteContentLength recomputes the "Content-Length" header when the
+	// length of the new body is known, or removes it otherwise.
+	RewriteContentLength RewritePolicy = 1 << iota
+
+	// RewriteRemoveValidators removes the "Content-MD5" and "ETag" headers,
+	// which no longer match the new body.
+	RewriteRemoveValidators
+
+	// DefaultRewritePolicy is the RewritePolicy unless overridden by
+	// BodyRewritePolicy.
+	DefaultRewritePolicy = RewriteContentLength | RewriteRemoveValidators
+)
+
+// BodyRewritePolicy sets how the host reconciles headers after the guest
+// overwrites a body. Defaults to DefaultRewritePolicy, and zero leaves
+// headers untouched.
+func BodyRewritePolicy(policy RewritePolicy) Option {
+	return func(h *options) {
+		h.rewritePolicy = policy
+	}
+}
+
+// MaxFormSize limits the size in bytes of a request body the host will
+// parse for handler.FuncGetFormNames and related functions. Defaults to
+// 10MiB. This also limits gRPC request messages parsed for
+// handler.FuncGetGRPCMessageCount, unless MaxRequestBuffer is set.
+func MaxFormSize(maxFormSize int64) Option {
+	return func(h *options) {
+		h.limits.MaxFormSize = maxFormSize
+	}
+}
+
 type options struct {
-	newRuntime   func(context.Context) (wazero.Runtime, error)
-	guestConfig  []byte
-	moduleConfig wazero.ModuleConfig
-	logger       api.Logger
+	newRuntime    func(context.Context) (wazero.Runtime, error)
+	guestConfig   []byte
+	moduleConfig  wazero.ModuleConfig
+	logger        api.Logger
+	limits        Limits
+	rewritePolicy RewritePolicy
+}
+
+// Limits are resource limits the host enforces per request, configured by
+// Option.
+type Limits struct {
+	// MaxInFlight is the size in bytes of each chunk of the request body read
+	// when streaming. See MaxInFlight.
+	MaxInFlight int
+
+	// MaxRequestBuffer is the size in bytes of the request body that can be
+	// buffered, or zero for unlimited. See MaxRequestBuffer.
+	MaxRequestBuffer int64
+
+	// RequestTooLargeStatus is the HTTP status code used when the request
+	// body exceeds MaxRequestBuffer. See RequestTooLargeStatus.
+	RequestTooLargeStatus uint32
+
+	// MaxResponseBuffer is the size in bytes of the response body that can be
+	// buffered, or zero for unlimited. See MaxResponseBuffer.
+	MaxResponseBuffer int64
+
+	// SpillThreshold is the size in bytes of a buffered body kept in memory,
+	// or zero to never spill to disk. See SpillToDisk.
+	SpillThreshold int64
+
+	// SpillDir is the directory of temporary files of spilled bodies. See
+	// SpillToDisk.
+	SpillDir string
+
+	// MaxFormSize is the size in bytes of a request body parsed as a form.
+	// See MaxFormSize.
+	MaxFormSize int64
+}
+
+// defaultLimits are the Limits used unless overridden by Option.
+var defaultLimits = Limits{
+	MaxInFlight:           32 << 10,
+	RequestTooLargeStatus: 413,
+	MaxFormSize:           10 << 20, // the same limit net/http uses.
 }
 
 // DefaultRuntime implements options.newRuntime.
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	wazeroapi "github.com/tetratelabs/wazero/api"
+
+	"github.com/httpwasm/http-wasm-host-go/api/handler"
+)
+
+// replaceBody implements the WebAssembly host function
+// handler.FuncReplaceBody.
+func (m *middleware) replaceBody(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	kind := handler.BodyKind(stack[0])
+	flags := handler.ReplaceFlags(stack[1])
+	pattern := uint32(stack[2])
+	patternLen := uint32(stack[3])
+	replacement := uint32(stack[4])
+	replacementLen := uint32(stack[5])
+
+	if flags&^handler.ReplaceFlagRegexp != 0 {
+		panic("unsupported replace flags: " + strconv.Itoa(int(flags)))
+	} else if patternLen == 0 {
+		panic("pattern cannot be empty")
+	}
+	p := mustRead(mod.Memory(), "pattern", pattern, patternLen)
+	repl := mustRead(mod.Memory(), "replacement", replacement, replacementLen)
+
+	s := requestStateFromContext(ctx)
+	var re *regexp.Regexp
+	if flags&handler.ReplaceFlagRegexp != 0 {
+		re = s.g.mustCompileReplace(string(p))
+	}
+
+	// Check the body can be written before consuming it.
+	switch kind {
+	case handler.BodyKindRequest:
+		if !s.inRequestBody {
+			_ = mustBeforeNext(ctx, "replace", "request body")
+		}
+	case handler.BodyKindResponse:
+		_ = mustResponseBodyAccessible(ctx, "replace")
+		if s.sentResponse {
+			panic(fmt.Errorf("can't replace response body after %s", handler.FuncSendResponse))
+		}
+	default:
+		panic("unsupported body kind: " + strconv.Itoa(int(kind)))
+	}
+
+	body, consumed := mustReadRemainingBody(m.mustBodyReader(ctx, kind))
+
+	var result []byte
+	var count int
+	if re != nil {
+		result, count = replaceRegexp(re, body, repl)
+	} else if count = bytes.Count(body, p); count > 0 {
+		result = bytes.Replace(body, p, repl, -1)
+	} else {
+		result = body
+	}
+
+	// Write the body back when it changed, or the request body would be lost
+	// as it isn't buffered.
+	if count > 0 || (consumed && kind == handler.BodyKindRequest &&
+		!s.afterNext && !s.features.IsEnabled(handler.FeatureBufferRequest)) {
+		m.mustOverwriteBody(ctx, s, kind, result)
+	}
+
+	// Read the result of the replacement next.
+	if kind == handler.BodyKindRequest {
+		_ = s.requestBodyReader.Close()
+		s.requestBodyBytes.b = result
+		s.requestBodyReader = &s.requestBodyBytes
+	} else {
+		_ = s.responseBodyReader.Close()
+		s.responseBodyBytes.b = result
+		s.responseBodyReader = &s.responseBodyBytes
+	}
+
+	stack[0] = uint64(count)
+}
+
+// mustReadRemainingBody returns what remains in the body reader, and whether
+// reading consumed it. A body held in memory is returned as-is.
+func mustReadRemainingBody(r io.Reader) ([]byte, bool) {
+	if br, ok := r.(*bytesBodyReader); ok {
+		return br.b, false
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		panic(fmt.Errorf("error reading body: %w", err))
+	}
+	return body, true
+}
+
+// mustOverwriteBody overwrites the BodyKind body, like the first call to
+// handler.FuncWriteBody. The next call to handler.FuncWriteBody appends.
+func (m *middleware) mustOverwriteBody(ctx context.Context, s *requestState, kind handler.BodyKind, body []byte) {
+	var w io.Writer
+	if kind == handler.BodyKindRequest {
+		s.grpcRequest = nil // the body changes.
+		w = m.host.RequestBodyWriter(ctx)
+		s.requestBodyWriter = w
+	} else {
+		s.grpcResponse = nil  // the body changes.
+		if s.inResponseBody { // the host sends headers before the body.
+			s.responseHeadersSent = true
+		}
+		w = m.host.ResponseBodyWriter(ctx)
+		s.responseBodyWriter = w
+	}
+	if _, err := w.Write(body); err != nil {
+		panic(fmt.Errorf("error writing body: %w", err))
+	}
+}
+
+// replaceRegexp returns the body with every match of the regular expression
+// replaced with the expanded replacement, and the count of matches.
+func replaceRegexp(re *regexp.Regexp, body, repl []byte) ([]byte, int) {
+	matches := re.FindAllSubmatchIndex(body, -1)
+	if len(matches) == 0 {
+		return body, 0
+	}
+	result := make([]byte, 0, len(body))
+	last := 0
+	for _, match := range matches {
+		result = append(result, body[last:match[0]]...)
+		result = re.Expand(result, repl, body, match)
+		last = match[1]
+	}
+	return append(result, body[last:]...), len(matches)
+}
+
+// mustCompileReplace compiles the regular expression of
+// handler.FuncReplaceBody, reusing the last one, as guests usually replace
+// the same pattern in each request.
+func (g *guest) mustCompileReplace(pattern string) *regexp.Regexp {
+	if re := g.replaceRegexp; re != nil && re.String() == pattern {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		panic(fmt.Errorf("invalid pattern: %w", err))
+	}
+	g.replaceRegexp = re
+	return re
+}
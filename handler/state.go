@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"io"
+	"mime/multipart"
 	"net/http"
 
 	"github.com/httpwasm/http-wasm-host-go/api/handler"
@@ -12,23 +13,71 @@ import (
 // pointer to the current request.
 type requestStateKey struct{}
 
+// requestStateFromContext returns the state of the current request. Host
+// functions are called with the context returned by HandleRequest, which is
+// the state itself, so this usually doesn't search the context.
 func requestStateFromContext(ctx context.Context) *requestState {
+	if s, ok := ctx.(*requestState); ok {
+		return s
+	}
 	return ctx.Value(requestStateKey{}).(*requestState)
 }
 
+// requestState is the state of the current request. It is also the
+// context.Context passed to the guest, so that host functions can find it
+// without allocating a context value. States are pooled, so must not be
+// used after Close.
 type requestState struct {
+	// Context is the context HandleRequest was called with.
+	context.Context
+
 	afterNext          bool
 	requestBodyReader  io.ReadCloser
 	requestBodyWriter  io.Writer
 	responseBodyReader io.ReadCloser
 	responseBodyWriter io.Writer
 
+	// requestBodyBytes and responseBodyBytes back the body readers when the
+	// host holds the body in memory, so that reading doesn't allocate.
+	requestBodyBytes, responseBodyBytes bytesBodyReader
+
+	// inRequestBody is true while the guest handles a request body chunk,
+	// when handler.FeatureStreamRequest is enabled.
+	inRequestBody bool
+
+	// inResponseBody is true while the guest handles a response body chunk,
+	// when handler.FeatureStreamResponse is enabled.
+	inResponseBody bool
+
+	// responseHeadersSent is true when streaming sent the response status
+	// code and headers, so they can no longer change.
+	responseHeadersSent bool
+
+	// sentResponse is true once the guest sent the whole response with
+	// handler.FuncSendResponse, so it can no longer change.
+	sentResponse bool
+
+	// form is the request form, lazily parsed by the first form function.
+	form *multipart.Form
+
+	// grpcRequest and grpcResponse are the gRPC messages in each body, lazily
+	// parsed by the first gRPC message function, or nil.
+	grpcRequest, grpcResponse []grpcMessage
+
 	// features are the current request's features which may be more than
 	// Middleware.Features.
 	features handler.Features
 
-	putPool func(x any)
-	g       *guest
+	m *middleware
+	g *guest
+}
+
+// Value implements the same method as documented on context.Context.
+func (r *requestState) Value(key any) any {
+	if key == (requestStateKey{}) {
+		return r
+	}
+	return r.Context.Value(key)
 }
 
 func (r *requestState) closeRequest() (err error) {
@@ -49,9 +98,15 @@ func (r *requestState) closeRequest() (err error) {
 //   - putting the guest module back into the pool
 //   - releasing any request body resources
 //   - releasing any response body resources
+//   - removing any temporary files of the request form
+//   - putting the state back into the pool
 func (r *requestState) Close() (err error) {
+	m := r.m
+	if m == nil {
+		return // already closed
+	}
 	if g := r.g; g != nil {
-		r.putPool(r.g)
+		m.pool.Put(r.g)
 		r.g = nil
 	}
 	err = r.closeRequest()
@@ -65,5 +120,13 @@ func (r *requestState) Close() (err error) {
 		err = respBR.Close()
 		r.responseBodyReader = nil
 	}
+	if f := r.form; f != nil {
+		if removeErr := f.RemoveAll(); err == nil {
+			err = removeErr
+		}
+		r.form = nil
+	}
+	*r = requestState{}
+	m.statePool.Put(r)
 	return
 }
@@ -35,6 +35,9 @@ var BinBenchRemoveHeader []byte
 //go:embed testdata/bench/read_body.wasm
 var BinBenchReadBody []byte
 
+//go:embed testdata/bench/read_body_buffered.wasm
+var BinBenchReadBodyBuffered []byte
+
 //go:embed testdata/bench/read_body_stream.wasm
 var BinBenchReadBodyStream []byte
 
@@ -44,6 +47,15 @@ var BinBenchWriteBody []byte
 //go:embed testdata/bench/set_status_code.wasm
 var BinBenchSetStatusCode []byte
 
+//go:embed testdata/bench/get_headers.wasm
+var BinBenchGetHeaders []byte
+
+//go:embed testdata/bench/get_header_names_values.wasm
+var BinBenchGetHeaderNamesValues []byte
+
+//go:embed testdata/bench/set_headers.wasm
+var BinBenchSetHeaders []byte
+
 var BinExampleAuth = func() []byte {
 	return binExample("auth")
 }()
@@ -77,15 +89,39 @@ var BinE2EMethod []byte
 //go:embed testdata/e2e/uri.wasm
 var BinE2EURI []byte
 
+//go:embed testdata/e2e/read_body_request.wasm
+var BinE2EReadBodyRequest []byte
+
+//go:embed testdata/e2e/stream_request.wasm
+var BinE2EStreamRequest []byte
+
+//go:embed testdata/e2e/stream_response.wasm
+var BinE2EStreamResponse []byte
+
+//go:embed testdata/e2e/query.wasm
+var BinE2EQuery []byte
+
+//go:embed testdata/e2e/authority.wasm
+var BinE2EAuthority []byte
+
 //go:embed testdata/e2e/header_value.wasm
 var BinE2EHeaderValue []byte
 
+//go:embed testdata/e2e/form.wasm
+var BinE2EForm []byte
+
 //go:embed testdata/e2e/handle_response.wasm
 var BinE2EHandleResponse []byte
 
 //go:embed testdata/e2e/header_names.wasm
 var BinE2EHeaderNames []byte
 
+//go:embed testdata/e2e/cookie.wasm
+var BinE2ECookie []byte
+
+//go:embed testdata/e2e/conn.wasm
+var BinE2EConn []byte
+
 //go:embed testdata/error/panic_on_handle_request.wasm
 var BinErrorPanicOnHandleRequest []byte
 
@@ -112,3 +148,39 @@ func binExample(name string) []byte {
 		return wasm
 	}
 }
+
+//go:embed testdata/e2e/decode_content.wasm
+var BinE2EDecodeContent []byte
+
+//go:embed testdata/e2e/trailers.wasm
+var BinE2ETrailers []byte
+
+//go:embed testdata/e2e/stream_trailers.wasm
+var BinE2EStreamTrailers []byte
+
+//go:embed testdata/e2e/grpc.wasm
+var BinE2EGRPC []byte
+
+//go:embed testdata/e2e/grpc_status.wasm
+var BinE2EGRPCStatus []byte
+
+//go:embed testdata/e2e/upgrade.wasm
+var BinE2EUpgrade []byte
+
+//go:embed testdata/e2e/early_hints.wasm
+var BinE2EEarlyHints []byte
+
+//go:embed testdata/e2e/status_code.wasm
+var BinE2EStatusCode []byte
+
+//go:embed testdata/e2e/send_response.wasm
+var BinE2ESendResponse []byte
+
+//go:embed testdata/e2e/copy_headers.wasm
+var BinE2ECopyHeaders []byte
+
+//go:embed testdata/e2e/body_len.wasm
+var BinE2EBodyLen []byte
+
+//go:embed testdata/e2e/replace_body.wasm
+var BinE2EReplaceBody []byte
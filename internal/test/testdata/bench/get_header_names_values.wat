@@ -0,0 +1,57 @@
+(module $get_header_names_values
+
+  (import "http_handler" "get_header_names" (func $get_header_names
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "get_header_values" (func $get_header_values
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $names i32 (i32.const 0))
+  (global $names_limit i32 (i32.const 1024))
+
+  (global $values i32 (i32.const 1024))
+  (global $values_limit i32 (i32.const 8192))
+
+  ;; handle_request reads all request headers the way guests did before
+  ;; get_headers: names, then the values of each name. This is a baseline
+  ;; for the get_headers benchmark.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $end i32)
+    (local $name i32)
+    (local $pos i32)
+
+    (local.set $end (i32.add (global.get $names)
+      (i32.wrap_i64
+        (call $get_header_names
+          (i32.const 0) ;; header_kind_request
+          (global.get $names) (global.get $names_limit)))))
+
+    (local.set $name (global.get $names))
+    (local.set $pos (global.get $names))
+    (block $done
+      (loop $bytes
+        (br_if $done (i32.ge_u (local.get $pos) (local.get $end)))
+        (if (i32.eqz (i32.load8_u (local.get $pos)))
+          (then
+            (drop (call $get_header_values
+              (i32.const 0) ;; header_kind_request
+              (local.get $name) (i32.sub (local.get $pos) (local.get $name))
+              (global.get $values) (global.get $values_limit)))
+            (local.set $name (i32.add (local.get $pos) (i32.const 1)))))
+        (local.set $pos (i32.add (local.get $pos) (i32.const 1)))
+        (br $bytes)))
+
+    ;; skip any next handler as the benchmark is about reading headers.
+    (return (i64.const 0)))
+
+  ;; handle_response should not be called as handle_request returns zero.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (unreachable))
+)
@@ -0,0 +1,25 @@
+(module $get_headers
+
+  (import "http_handler" "get_headers" (func $get_headers
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $buf i32 (i32.const 0))
+  (global $buf_limit i32 (i32.const 8192))
+
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (call $get_headers
+      (i32.const 0) ;; header_kind_request
+      (global.get $buf) (global.get $buf_limit))
+    (drop)
+
+    ;; skip any next handler as the benchmark is about get_headers.
+    (return (i64.const 0)))
+
+  ;; handle_response should not be called as handle_request returns zero.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (unreachable))
+)
@@ -0,0 +1,51 @@
+(module $read_body_buffered
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "body_len" (func $body_len
+    (param $kind i32)
+    (result (; len or -1 ;) i64)))
+
+  (import "http_handler" "read_body" (func $read_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)
+    (result (; 0 or EOF(1) << 32 | len ;) i64)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; eof is the upper 32-bits of the $read_body result on EOF.
+  (global $eof i64 (i64.const 4294967296)) ;; `1<<32|0`
+
+  ;; start enables buffering of the request body.
+  (start $main)
+  (func $main
+    (drop (call $enable_features
+      (i32.const 1)))) ;; feature_buffer_request
+
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i64)
+
+    ;; size the read by the length of the body
+    (local.set $len (call $body_len (i32.const 0))) ;; body_kind_request
+
+    ;; if len <= 0 { panic }
+    (if (i64.le_s (local.get $len) (i64.const 0))
+      (then unreachable)) ;; the length isn't known
+
+    ;; if read_body != eof|len { panic }
+    (if (i64.ne
+          (call $read_body
+            (i32.const 0) ;; body_kind_request
+            (i32.const 0) (i32.wrap_i64 (local.get $len)))
+          (i64.or (global.get $eof) (local.get $len)))
+      (then unreachable)) ;; fail as we couldn't read the whole body.
+
+    ;; skip any next handler as the benchmark is about read_body.
+    (return (i64.const 0)))
+
+  ;; handle_response should not be called as handle_request returns zero.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (unreachable))
+)
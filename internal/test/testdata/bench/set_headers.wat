@@ -0,0 +1,24 @@
+(module $set_headers
+
+  (import "http_handler" "set_headers" (func $set_headers
+    (param $kind i32)
+    (param $headers i32) (param $headers_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $headers i32 (i32.const 0))
+  (data (i32.const 0) "Content-Type\00text/plain\00Cache-Control\00no-store\00Set-Cookie\00a=b\00Set-Cookie\00c=d\00")
+  (global $headers_len i32 (i32.const 77))
+
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (call $set_headers
+      (i32.const 1) ;; header_kind_response
+      (global.get $headers) (global.get $headers_len))
+
+    ;; skip any next handler as the benchmark is about set_headers.
+    (return (i64.const 0)))
+
+  ;; handle_response should not be called as handle_request returns zero.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (unreachable))
+)
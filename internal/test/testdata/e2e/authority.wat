@@ -0,0 +1,66 @@
+(module $authority
+
+  (import "http_handler" "get_scheme" (func $get_scheme
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "get_authority" (func $get_authority
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "set_authority" (func $set_authority
+    (param $authority i32) (param $authority_len i32)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $authority i32 (i32.const 0))
+  (data (i32.const 0) "example.com")
+  (global $authority_len i32 (i32.const 11))
+
+  (global $sep i32 (i32.const 16))
+  (data (i32.const 16) "://")
+
+  (global $buf i32 (i32.const 1024))
+
+  ;; handle_request writes the scheme and authority, like the beginning of a
+  ;; URL, to the response body. Then, it changes the authority and returns
+  ;; non-zero to proceed to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    ;; read the scheme into memory.
+    (local.set $len
+      (call $get_scheme (global.get $buf) (i32.const 1024)))
+
+    ;; write the scheme to the response body.
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; write the separator to the response body.
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $sep) (i32.const 3))
+
+    ;; read the authority into memory.
+    (local.set $len
+      (call $get_authority (global.get $buf) (i32.const 1024)))
+
+    ;; write the authority to the response body.
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; change the authority
+    (call $set_authority (global.get $authority) (global.get $authority_len))
+
+    ;; execute test case handler to verify assertions
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
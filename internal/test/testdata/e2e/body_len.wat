@@ -0,0 +1,91 @@
+(module $body_len
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "body_len" (func $body_len
+    (param $kind i32)
+    (result (; len or -1 ;) i64)))
+
+  (import "http_handler" "read_body" (func $read_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; 0 or EOF(1) << 32 | len ;) i64)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; kind is the body kind to echo, from the config.
+  (global $kind (mut i32) (i32.const 0))
+
+  (global $unknown i32 (i32.const 16))
+  (data (i32.const 16) "unknown")
+  (global $unknown_len i32 (i32.const 7))
+
+  (global $buf i32 (i32.const 1024))
+
+  ;; start reads the little-endian uint32 body kind from the config, and
+  ;; enables buffering of that body.
+  (start $main)
+  (func $main
+    (if (i32.ne (call $get_config (i32.const 0) (i32.const 4)) (i32.const 4))
+      (then unreachable))
+    (global.set $kind (i32.load (i32.const 0)))
+
+    (drop (call $enable_features
+      (i32.shl (i32.const 1) (global.get $kind))))) ;; feature_buffer_XXX
+
+  ;; echo reads the body of the kind in one call sized by body_len, and
+  ;; writes it to the response body. If the length is unknown, it writes
+  ;; "unknown" instead.
+  (func $echo (param $kind i32)
+    (local $len i64)
+
+    (local.set $len (call $body_len (local.get $kind)))
+    (if (i64.eq (local.get $len) (i64.const -1))
+      (then
+        (call $write_body
+          (i32.const 1) ;; body_kind_response
+          (global.get $unknown) (global.get $unknown_len))
+        (return)))
+
+    (if (i64.gt_u (local.get $len) (i64.const 0))
+      (then
+        ;; read exactly the length, which must reach EOF.
+        (if (i64.ne
+              (call $read_body
+                (local.get $kind)
+                (global.get $buf) (i32.wrap_i64 (local.get $len)))
+              (i64.or (i64.const 0x100000000) (local.get $len)))
+          (then unreachable))))
+
+    ;; nothing remains after reading.
+    (if (i64.ne (call $body_len (local.get $kind)) (i64.const 0))
+      (then unreachable))
+
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (i32.wrap_i64 (local.get $len))))
+
+  ;; handle_request echoes the request body, or proceeds to the next handler
+  ;; to echo the response body.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (if (i32.eqz (global.get $kind))
+      (then
+        (call $echo (i32.const 0)) ;; body_kind_request
+        (return (i64.const 0))))
+    (return (i64.const 1)))
+
+  ;; handle_response echoes the response body, if configured.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (if (i32.eq (global.get $kind) (i32.const 1))
+      (then (call $echo (i32.const 1))))) ;; body_kind_response
+)
@@ -0,0 +1,55 @@
+(module $conn
+
+  (import "http_handler" "get_remote_addr" (func $get_remote_addr
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "get_tls_version" (func $get_tls_version
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $sep i32 (i32.const 0))
+  (data (i32.const 0) "|")
+
+  (global $buf i32 (i32.const 1024))
+
+  ;; handle_request writes the remote address and TLS version, separated by
+  ;; a pipe, to the response body.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    ;; read the remote address into memory.
+    (local.set $len
+      (call $get_remote_addr (global.get $buf) (i32.const 1024)))
+
+    ;; write the remote address to the response body.
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; write the separator to the response body.
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $sep) (i32.const 1))
+
+    ;; read the TLS version into memory.
+    (local.set $len
+      (call $get_tls_version (global.get $buf) (i32.const 1024)))
+
+    ;; write the TLS version to the response body.
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; skip any next handler as we wrote the response body.
+    (return (i64.const 0)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
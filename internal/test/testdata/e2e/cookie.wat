@@ -0,0 +1,67 @@
+(module $cookie
+
+  (import "http_handler" "get_cookie_values" (func $get_cookie_values
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "set_cookie" (func $set_cookie
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)
+    (param $path i32) (param $path_len i32)
+    (param $domain i32) (param $domain_len i32)
+    (param $max_age i32)
+    (param $flags i32)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "session")
+  (global $name_len i32 (i32.const 7))
+
+  (global $value i32 (i32.const 16))
+  (data (i32.const 16) "2")
+  (global $value_len i32 (i32.const 1))
+
+  (global $path i32 (i32.const 32))
+  (data (i32.const 32) "/")
+  (global $path_len i32 (i32.const 1))
+
+  (global $buf i32 (i32.const 1024))
+
+  ;; handle_request writes the value of the "session" request cookie to the
+  ;; response body and sets a new "session" cookie.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    ;; read the values of the "session" cookie into memory.
+    (local.set $len
+      (i32.wrap_i64
+        (call $get_cookie_values
+          (global.get $name) (global.get $name_len)
+          (global.get $buf) (i32.const 1024))))
+
+    ;; set the new cookie before the response body is written.
+    (call $set_cookie
+      (global.get $name) (global.get $name_len)
+      (global.get $value) (global.get $value_len)
+      (global.get $path) (global.get $path_len)
+      (i32.const 0) (i32.const 0) ;; no domain
+      (i32.const 3600) ;; max_age
+      (i32.const 7)) ;; secure|http_only|same_site_lax
+
+    ;; write the value, without its NUL terminator, to the response body.
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (i32.sub (local.get $len) (i32.const 1)))
+
+    ;; skip any next handler as we wrote the response.
+    (return (i64.const 0)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
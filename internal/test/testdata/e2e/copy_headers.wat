@@ -0,0 +1,35 @@
+(module $copy_headers
+
+  (import "http_handler" "get_headers" (func $get_headers
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "set_headers" (func $set_headers
+    (param $kind i32)
+    (param $headers i32) (param $headers_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $buf i32 (i32.const 0))
+  (global $buf_limit i32 (i32.const 65536))
+
+  ;; handle_request copies all request headers to the response in two calls,
+  ;; as get_headers writes the same format set_headers reads.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    (local.set $len (i32.wrap_i64
+      (call $get_headers
+        (i32.const 0) ;; header_kind_request
+        (global.get $buf) (global.get $buf_limit))))
+    (call $set_headers
+      (i32.const 1) ;; header_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; uint32(ctx_next) == 1 means proceed to the next handler on the host.
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,88 @@
+(module $decode_content
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "read_body" (func $read_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; 0 or EOF(1) << 32 | len ;) i64)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $buf i32 (i32.const 1024))
+  (global $buf_limit i32 (i32.const 1024))
+
+  ;; start enables the little-endian uint32 features in the config.
+  (start $main)
+  (func $main
+    (if (i32.ne (call $get_config (i32.const 0) (i32.const 4)) (i32.const 4))
+      (then unreachable))
+    (drop (call $enable_features (i32.load (i32.const 0)))))
+
+  ;; read_all reads the body of the given kind into buf, returning its length.
+  (func $read_all (param $kind i32) (result (; len ;) i32)
+    (local $len i32)
+    (local $result i64)
+
+    (loop $chunks
+      (local.set $result
+        (call $read_body
+          (local.get $kind)
+          (i32.add (global.get $buf) (local.get $len))
+          (i32.sub (global.get $buf_limit) (local.get $len))))
+
+      (local.set $len
+        (i32.add (local.get $len) (i32.wrap_i64 (local.get $result))))
+
+      ;; loop until EOF.
+      (br_if $chunks (i64.eq (i64.shr_u (local.get $result) (i64.const 32)) (i64.const 0))))
+
+    (local.get $len))
+
+  ;; handle_request writes back the request body it read, then proceeds to
+  ;; the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    (local.set $len (call $read_all (i32.const 0))) ;; body_kind_request
+    (call $write_body
+      (i32.const 0) ;; body_kind_request
+      (global.get $buf) (local.get $len))
+
+    (return (i64.const 1)))
+
+  ;; handle_response overwrites the response body with its upper-case form.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (local $len i32)
+    (local $i i32)
+    (local $c i32)
+
+    (local.set $len (call $read_all (i32.const 1))) ;; body_kind_response
+
+    (block $done
+      (loop $bytes
+        (br_if $done (i32.ge_u (local.get $i) (local.get $len)))
+        (local.set $c (i32.load8_u (i32.add (global.get $buf) (local.get $i))))
+        (if (i32.and
+              (i32.ge_u (local.get $c) (i32.const 0x61))  ;; 'a'
+              (i32.le_u (local.get $c) (i32.const 0x7a))) ;; 'z'
+          (then (i32.store8
+                  (i32.add (global.get $buf) (local.get $i))
+                  (i32.sub (local.get $c) (i32.const 0x20)))))
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $bytes)))
+
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len)))
+)
@@ -0,0 +1,44 @@
+(module $early_hints
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "add_header_value" (func $add_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (import "http_handler" "send_informational" (func $send_informational
+    (param $status_code i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $link i32 (i32.const 0))
+  (data (i32.const 0) "Link")
+  (global $link_len i32 (i32.const 4))
+
+  (global $preload i32 (i32.const 16))
+  (data (i32.const 16) "</style.css>; rel=preload; as=style")
+  (global $preload_len i32 (i32.const 35))
+
+  ;; handle_request enables response buffering, to show 103 Early Hints are
+  ;; sent regardless. Then, it adds a "Link" response header to preload a
+  ;; stylesheet and sends it with status 103 before proceeding.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (drop (call $enable_features
+      (i32.const 2))) ;; feature_buffer_response
+
+    (call $add_header_value
+      (i32.const 1) ;; header_kind_response
+      (global.get $link) (global.get $link_len)
+      (global.get $preload) (global.get $preload_len))
+
+    (call $send_informational (i32.const 103))
+
+    ;; uint32(ctx_next) == 1 means proceed to the next handler on the host.
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
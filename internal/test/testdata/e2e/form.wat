@@ -0,0 +1,64 @@
+(module $form
+
+  (import "http_handler" "get_form_values" (func $get_form_values
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "get_form_file_headers" (func $get_form_file_headers
+    (param $name i32) (param $name_len i32)
+    (param $index i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "name")
+  (global $name_len i32 (i32.const 4))
+
+  (global $upload i32 (i32.const 16))
+  (data (i32.const 16) "upload")
+  (global $upload_len i32 (i32.const 6))
+
+  (global $buf i32 (i32.const 1024))
+
+  ;; handle_request writes the NUL-terminated values of the "name" form field,
+  ;; then the headers of the first file in the "upload" form field, to the
+  ;; response body. Then, it returns non-zero to proceed to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    ;; read the values of "name" into memory.
+    (local.set $len
+      (i32.wrap_i64
+        (call $get_form_values
+          (global.get $name) (global.get $name_len)
+          (global.get $buf) (i32.const 1024))))
+
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; read the headers of the first "upload" file into memory.
+    (local.set $len
+      (i32.wrap_i64
+        (call $get_form_file_headers
+          (global.get $upload) (global.get $upload_len)
+          (i32.const 0) ;; index
+          (global.get $buf) (i32.const 1024))))
+
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; execute test case handler to verify assertions
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,113 @@
+(module $grpc
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_grpc_message_count" (func $get_grpc_message_count
+    (param $kind i32)
+    (result (; count ;) i32)))
+
+  (import "http_handler" "read_grpc_message" (func $read_grpc_message
+    (param $kind i32) (param $index i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; compressed << 32 | len ;) i64)))
+
+  (import "http_handler" "send_grpc_status" (func $send_grpc_status
+    (param $code i32)
+    (param $message i32) (param $message_len i32)))
+
+  (import "http_handler" "get_header_values" (func $get_header_values
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "set_header_value" (func $set_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $no_messages i32 (i32.const 0))
+  (data (i32.const 0) "no messages")
+  (global $no_messages_len i32 (i32.const 11))
+
+  (global $denied i32 (i32.const 16))
+  (data (i32.const 16) "denied: 100%")
+  (global $denied_len i32 (i32.const 12))
+
+  (global $grpc_status i32 (i32.const 32))
+  (data (i32.const 32) "Grpc-Status")
+  (global $grpc_status_len i32 (i32.const 11))
+
+  (global $seen_status i32 (i32.const 48))
+  (data (i32.const 48) "X-Seen-Grpc-Status")
+  (global $seen_status_len i32 (i32.const 18))
+
+  (global $messages i32 (i32.const 80))
+  (data (i32.const 80) "X-Response-Messages")
+  (global $messages_len i32 (i32.const 19))
+
+  (global $buf i32 (i32.const 1024))
+  (global $buf_limit i32 (i32.const 1024))
+
+  ;; start enables buffering and trailers, so that the guest can read
+  ;; messages of both bodies and the trailers of the response.
+  (start $main)
+  (func $main
+    (drop (call $enable_features
+      (i32.const 7)))) ;; feature_buffer_request|feature_buffer_response|feature_trailers
+
+  ;; handle_request responds with INVALID_ARGUMENT(3) if the request has no
+  ;; messages, or PERMISSION_DENIED(7) if the first starts with 'd'.
+  ;; Otherwise, it proceeds to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (if (i32.eqz (call $get_grpc_message_count (i32.const 0))) ;; body_kind_request
+      (then
+        (call $send_grpc_status (i32.const 3)
+          (global.get $no_messages) (global.get $no_messages_len))
+        (return (i64.const 0))))
+
+    (drop (call $read_grpc_message
+      (i32.const 0) ;; body_kind_request
+      (i32.const 0) ;; index
+      (global.get $buf) (global.get $buf_limit)))
+
+    (if (i32.eq (i32.load8_u (global.get $buf)) (i32.const 0x64)) ;; 'd'
+      (then
+        (call $send_grpc_status (i32.const 7)
+          (global.get $denied) (global.get $denied_len))
+        (return (i64.const 0))))
+
+    (return (i64.const 1)))
+
+  ;; handle_response copies the first "Grpc-Status" response trailer to the
+  ;; "X-Seen-Grpc-Status" trailer, and sets the count of response messages as
+  ;; a single digit in the "X-Response-Messages" trailer.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (local $len i32)
+
+    (local.set $len
+      (i32.wrap_i64
+        (call $get_header_values
+          (i32.const 3) ;; header_kind_response_trailers
+          (global.get $grpc_status) (global.get $grpc_status_len)
+          (global.get $buf) (global.get $buf_limit))))
+
+    (if (local.get $len)
+      (then
+        (call $set_header_value
+          (i32.const 3) ;; header_kind_response_trailers
+          (global.get $seen_status) (global.get $seen_status_len)
+          (global.get $buf) (i32.sub (local.get $len) (i32.const 1))))) ;; drop the NUL
+
+    (i32.store8 (global.get $buf)
+      (i32.add (i32.const 0x30) ;; '0'
+        (call $get_grpc_message_count (i32.const 1)))) ;; body_kind_response
+    (call $set_header_value
+      (i32.const 3) ;; header_kind_response_trailers
+      (global.get $messages) (global.get $messages_len)
+      (global.get $buf) (i32.const 1)))
+)
@@ -0,0 +1,33 @@
+(module $grpc_status
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "send_grpc_status" (func $send_grpc_status
+    (param $code i32)
+    (param $message i32) (param $message_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; config is the little-endian uint32 gRPC status code.
+  (global $config i32 (i32.const 0))
+  (global $config_limit i32 (i32.const 4))
+
+  (start $main)
+  (func $main
+    (if (i32.lt_u
+          (call $get_config (global.get $config) (global.get $config_limit))
+          (i32.const 4))
+      (then unreachable)))
+
+  ;; handle_request responds with the configured gRPC status, without a
+  ;; message.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (call $send_grpc_status (i32.load (global.get $config))
+      (i32.const 0) (i32.const 0))
+    (return (i64.const 0)))
+
+  ;; handle_response is no-op as the request isn't proceeded.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,73 @@
+(module $query
+
+  (import "http_handler" "get_query_values" (func $get_query_values
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "set_query_value" (func $set_query_value
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (import "http_handler" "add_query_value" (func $add_query_value
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "name")
+  (global $name_len i32 (i32.const 4))
+
+  (global $teddy i32 (i32.const 16))
+  (data (i32.const 16) "teddy")
+  (global $teddy_len i32 (i32.const 5))
+
+  (global $tag i32 (i32.const 32))
+  (data (i32.const 32) "tag")
+  (global $tag_len i32 (i32.const 3))
+
+  (global $tag_value i32 (i32.const 48))
+  (data (i32.const 48) "a&b")
+  (global $tag_value_len i32 (i32.const 3))
+
+  (global $buf i32 (i32.const 1024))
+
+  ;; handle_request writes the first value of the "name" query parameter to
+  ;; the request body. Then, it changes that value, adds the "tag" parameter,
+  ;; and returns non-zero to proceed to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    ;; read the values of "name" into memory.
+    (local.set $len
+      (i32.wrap_i64
+        (call $get_query_values
+          (global.get $name) (global.get $name_len)
+          (global.get $buf) (i32.const 1024))))
+
+    ;; write the value, without its NUL terminator, to the request body.
+    (call $write_body
+      (i32.const 0) ;; body_kind_request
+      (global.get $buf) (i32.sub (local.get $len) (i32.const 1)))
+
+    ;; change the value of "name".
+    (call $set_query_value
+      (global.get $name) (global.get $name_len)
+      (global.get $teddy) (global.get $teddy_len))
+
+    ;; add a value that needs escaping.
+    (call $add_query_value
+      (global.get $tag) (global.get $tag_len)
+      (global.get $tag_value) (global.get $tag_value_len))
+
+    ;; execute test case handler to verify assertions
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,67 @@
+(module $read_body_request
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "read_body" (func $read_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; 0 or EOF(1) << 32 | len ;) i64)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; limit is the count of request body bytes to read, from the config.
+  (global $limit (mut i32) (i32.const 0))
+
+  (global $buf i32 (i32.const 1024))
+  (global $buf_limit i32 (i32.const 1024))
+
+  ;; start enables buffering of the request body and reads the little-endian
+  ;; uint32 limit from the config.
+  (start $main)
+  (func $main
+    (drop (call $enable_features
+      (i32.const 1))) ;; feature_buffer_request
+
+    (if (i32.ne (call $get_config (i32.const 0) (i32.const 4)) (i32.const 4))
+      (then unreachable))
+    (global.set $limit (i32.load (i32.const 0))))
+
+  ;; handle_request reads up to limit bytes of the request body, in chunks of
+  ;; at most buf_limit, then proceeds to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $read i32)
+    (local $result i64)
+    (local $chunk_limit i32)
+
+    (block $done
+      (loop $chunks
+        (br_if $done (i32.ge_u (local.get $read) (global.get $limit)))
+
+        ;; chunk_limit = min(limit - read, buf_limit)
+        (local.set $chunk_limit (i32.sub (global.get $limit) (local.get $read)))
+        (if (i32.gt_u (local.get $chunk_limit) (global.get $buf_limit))
+          (then (local.set $chunk_limit (global.get $buf_limit))))
+
+        (local.set $result
+          (call $read_body
+            (i32.const 0) ;; body_kind_request
+            (global.get $buf) (local.get $chunk_limit)))
+
+        (local.set $read
+          (i32.add (local.get $read) (i32.wrap_i64 (local.get $result))))
+
+        ;; stop at EOF.
+        (br_if $done (i64.ne (i64.shr_u (local.get $result) (i64.const 32)) (i64.const 0)))
+        (br $chunks)))
+
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
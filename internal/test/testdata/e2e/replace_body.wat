@@ -0,0 +1,88 @@
+(module $replace_body
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "replace_body" (func $replace_body
+    (param $kind i32) (param $flags i32)
+    (param $pattern i32) (param $pattern_len i32)
+    (param $replacement i32) (param $replacement_len i32)
+    (result (; count ;) i32)))
+
+  (import "http_handler" "set_header_value" (func $set_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; The config is the body kind, the flags and the length of the pattern,
+  ;; one byte each, followed by the pattern, then the replacement.
+  (global $kind (mut i32) (i32.const 0))
+  (global $flags (mut i32) (i32.const 0))
+  (global $pattern i32 (i32.const 3))
+  (global $pattern_len (mut i32) (i32.const 0))
+  (global $replacement (mut i32) (i32.const 0))
+  (global $replacement_len (mut i32) (i32.const 0))
+
+  (global $count_name i32 (i32.const 1024))
+  (data (i32.const 1024) "x-replacements")
+  (global $count_name_len i32 (i32.const 14))
+
+  ;; count_value is where the count is written as a decimal digit.
+  (global $count_value i32 (i32.const 1040))
+
+  ;; start enables buffering of both bodies and reads the config.
+  (start $main)
+  (func $main
+    (local $config_len i32)
+
+    (drop (call $enable_features
+      (i32.const 3))) ;; feature_buffer_request|feature_buffer_response
+
+    (local.set $config_len (call $get_config (i32.const 0) (i32.const 1024)))
+    (if (i32.lt_u (local.get $config_len) (i32.const 3))
+      (then unreachable))
+
+    (global.set $kind (i32.load8_u (i32.const 0)))
+    (global.set $flags (i32.load8_u (i32.const 1)))
+    (global.set $pattern_len (i32.load8_u (i32.const 2)))
+    (global.set $replacement
+      (i32.add (global.get $pattern) (global.get $pattern_len)))
+    (global.set $replacement_len
+      (i32.sub (local.get $config_len) (global.get $replacement))))
+
+  ;; replace replaces the pattern in the body of the configured kind, and
+  ;; sets the count of replacements as a response header.
+  (func $replace
+    (i32.store8
+      (global.get $count_value)
+      (i32.add
+        (i32.const 48) ;; 0 in ASCII
+        (call $replace_body
+          (global.get $kind) (global.get $flags)
+          (global.get $pattern) (global.get $pattern_len)
+          (global.get $replacement) (global.get $replacement_len))))
+
+    (call $set_header_value
+      (i32.const 1) ;; header_kind_response
+      (global.get $count_name) (global.get $count_name_len)
+      (global.get $count_value) (i32.const 1)))
+
+  ;; handle_request replaces in the request body, if configured, then
+  ;; proceeds to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (if (i32.eqz (global.get $kind))
+      (then (call $replace)))
+    (return (i64.const 1)))
+
+  ;; handle_response replaces in the response body, if configured.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (if (i32.eq (global.get $kind) (i32.const 1))
+      (then (call $replace))))
+)
@@ -0,0 +1,56 @@
+(module $send_response
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "send_response" (func $send_response
+    (param $status_code i32)
+    (param $headers i32) (param $headers_len i32)
+    (param $body i32) (param $body_len i32)))
+
+  (import "http_handler" "set_status_code" (func $set_status_code
+    (param $status_code i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $headers i32 (i32.const 0))
+  (data (i32.const 0) "WWW-Authenticate\00Basic realm=\"test\"\00Content-Type\00text/plain\00")
+  (global $headers_len i32 (i32.const 60))
+
+  (global $body i32 (i32.const 128))
+  (data (i32.const 128) "unauthorized")
+  (global $body_len i32 (i32.const 12))
+
+  ;; mode is the first byte of the config:
+  ;;   0: send the response
+  ;;   1: send the response, then try to change its status code
+  ;;   2: send the response with headers missing their NUL terminator
+  ;;   3: send the response, then proceed to the next handler
+  ;;   4: set the status code, then try to send the response
+  (global $mode (mut i32) (i32.const 0))
+
+  (start $main)
+  (func $main
+    (if (i32.eq (call $get_config (i32.const 1024) (i32.const 1)) (i32.const 1))
+      (then (global.set $mode (i32.load8_u (i32.const 1024))))))
+
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (if (i32.eq (global.get $mode) (i32.const 4))
+      (then (call $set_status_code (i32.const 202))))
+
+    (call $send_response
+      (i32.const 401)
+      (global.get $headers)
+      (i32.sub (global.get $headers_len) (i32.eq (global.get $mode) (i32.const 2)))
+      (global.get $body) (global.get $body_len))
+
+    (if (i32.eq (global.get $mode) (i32.const 1))
+      (then (call $set_status_code (i32.const 200))))
+
+    ;; uint32(ctx_next) == 1 means proceed to the next handler on the host.
+    (return (i64.extend_i32_u (i32.eq (global.get $mode) (i32.const 3)))))
+
+  ;; handle_response is no-op as the guest never proceeds.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,66 @@
+(module $status_code
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "set_status_code" (func $set_status_code
+    (param $status_code i32)))
+
+  (import "http_handler" "set_reason_phrase" (func $set_reason_phrase
+    (param $reason i32) (param $reason_len i32)))
+
+  (import "http_handler" "get_status_code" (func $get_status_code
+    (result (; status_code ;) i32)))
+
+  (import "http_handler" "log" (func $log
+    (param $level i32)
+    (param $buf i32) (param $buf_limit i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; config is the little-endian uint32 status code, followed by any reason
+  ;; phrase.
+  (global $config i32 (i32.const 0))
+  (global $config_limit i32 (i32.const 1024))
+  (global $config_len (mut i32) (i32.const 0))
+
+  ;; message is where log messages are formatted.
+  (global $message i32 (i32.const 1024))
+
+  (start $main)
+  (func $main
+    (global.set $config_len
+      (call $get_config (global.get $config) (global.get $config_limit)))
+    (if (i32.lt_u (global.get $config_len) (i32.const 4))
+      (then unreachable)))
+
+  ;; handle_request proceeds to the next handler if the configured status
+  ;; code is zero. Otherwise, it responds with it and any reason phrase, set
+  ;; first as the status code may be sent immediately.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (if (i32.eqz (i32.load (global.get $config)))
+      (then (return (i64.const 1))))
+
+    (if (i32.gt_u (global.get $config_len) (i32.const 4))
+      (then (call $set_reason_phrase
+        (i32.add (global.get $config) (i32.const 4))
+        (i32.sub (global.get $config_len) (i32.const 4)))))
+    (call $set_status_code (i32.load (global.get $config)))
+    (return (i64.const 0)))
+
+  ;; handle_response logs the status code as three digits.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (local $status_code i32)
+
+    (local.set $status_code (call $get_status_code))
+    (i32.store8 (global.get $message)
+      (i32.add (i32.const 0x30) (i32.div_u (local.get $status_code) (i32.const 100))))
+    (i32.store8 (i32.add (global.get $message) (i32.const 1))
+      (i32.add (i32.const 0x30) (i32.rem_u (i32.div_u (local.get $status_code) (i32.const 10)) (i32.const 10))))
+    (i32.store8 (i32.add (global.get $message) (i32.const 2))
+      (i32.add (i32.const 0x30) (i32.rem_u (local.get $status_code) (i32.const 10))))
+    (call $log
+      (i32.const 0) ;; log_level_info
+      (global.get $message) (i32.const 3)))
+)
@@ -0,0 +1,86 @@
+(module $stream_request
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "read_body" (func $read_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; 0 or EOF(1) << 32 | len ;) i64)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $separator i32 (i32.const 0))
+  (data (i32.const 0) "|")
+  (global $separator_len i32 (i32.const 1))
+
+  (global $end i32 (i32.const 16))
+  (data (i32.const 16) "!")
+  (global $end_len i32 (i32.const 1))
+
+  (global $buf i32 (i32.const 1024))
+  (global $buf_limit i32 (i32.const 1024))
+
+  ;; handle_request enables streaming of the request body, then proceeds to
+  ;; the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (drop (call $enable_features
+      (i32.const 16))) ;; feature_stream_request
+
+    (return (i64.const 1)))
+
+  ;; handle_request_body upper-cases each chunk and appends '|' to it, except
+  ;; chunks starting with '#', which pass through. At the end of the stream,
+  ;; it writes "!".
+  (func (export "handle_request_body") (param $reqCtx i32) (param $end_of_stream i32)
+    (local $len i32)
+    (local $i i32)
+    (local $b i32)
+
+    (if (local.get $end_of_stream)
+      (then
+        (call $write_body
+          (i32.const 0) ;; body_kind_request
+          (global.get $end) (global.get $end_len))
+        (return)))
+
+    ;; read the chunk, which is smaller than the buffer in tests.
+    (local.set $len
+      (i32.wrap_i64
+        (call $read_body
+          (i32.const 0) ;; body_kind_request
+          (global.get $buf) (global.get $buf_limit))))
+
+    ;; don't write, so that the chunk passes through.
+    (if (i32.eq (i32.load8_u (global.get $buf)) (i32.const 35)) ;; '#'
+      (then (return)))
+
+    (block $done
+      (loop $chars
+        (br_if $done (i32.ge_u (local.get $i) (local.get $len)))
+        (local.set $b (i32.load8_u (i32.add (global.get $buf) (local.get $i))))
+        (if (i32.and
+              (i32.ge_u (local.get $b) (i32.const 97))   ;; 'a'
+              (i32.le_u (local.get $b) (i32.const 122))) ;; 'z'
+          (then
+            (i32.store8
+              (i32.add (global.get $buf) (local.get $i))
+              (i32.sub (local.get $b) (i32.const 32)))))
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $chars)))
+
+    (call $write_body
+      (i32.const 0) ;; body_kind_request
+      (global.get $buf) (local.get $len))
+    (call $write_body
+      (i32.const 0) ;; body_kind_request
+      (global.get $separator) (global.get $separator_len)))
+
+  ;; handle_response is no-op as the body was handled in chunks.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
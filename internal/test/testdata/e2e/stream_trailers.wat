@@ -0,0 +1,48 @@
+(module $stream_trailers
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "set_header_value" (func $set_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "X-Chunks")
+  (global $name_len i32 (i32.const 8))
+
+  ;; value is the count of chunks as a single digit.
+  (global $value i32 (i32.const 16))
+
+  (global $chunks (mut i32) (i32.const 0))
+
+  ;; handle_request enables streaming of the response body and trailers, then
+  ;; proceeds to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (drop (call $enable_features
+      (i32.const 12))) ;; feature_trailers|feature_stream_response
+
+    (global.set $chunks (i32.const 0))
+    (return (i64.const 1)))
+
+  ;; handle_response_body counts chunks passing through. At the end of the
+  ;; stream, it sets the count as the "X-Chunks" response trailer.
+  (func (export "handle_response_body") (param $reqCtx i32) (param $end_of_stream i32)
+    (if (i32.eqz (local.get $end_of_stream))
+      (then
+        (global.set $chunks (i32.add (global.get $chunks) (i32.const 1)))
+        (return)))
+
+    (i32.store8 (global.get $value) (i32.add (i32.const 0x30) (global.get $chunks))) ;; '0' + chunks
+    (call $set_header_value
+      (i32.const 3) ;; header_kind_response_trailers
+      (global.get $name) (global.get $name_len)
+      (global.get $value) (i32.const 1)))
+
+  ;; handle_response is no-op as trailers are set while streaming.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,93 @@
+(module $trailers
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "read_body" (func $read_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; 0 or EOF(1) << 32 | len ;) i64)))
+
+  (import "http_handler" "get_header_values" (func $get_header_values
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "add_header_value" (func $add_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "X-Checksum")
+  (global $name_len i32 (i32.const 10))
+
+  (global $echo_name i32 (i32.const 16))
+  (data (i32.const 16) "X-Checksum-Echo")
+  (global $echo_name_len i32 (i32.const 15))
+
+  (global $buf i32 (i32.const 1024))
+  (global $buf_limit i32 (i32.const 1024))
+
+  ;; start enables trailers and buffering, so that the request body can be
+  ;; read before the next handler, and response trailers set after it.
+  (start $main)
+  (func $main
+    (drop (call $enable_features
+      (i32.const 7)))) ;; feature_buffer_request|feature_buffer_response|feature_trailers
+
+  ;; handle_request reads the request body to EOF, so that its trailers are
+  ;; readable. Then, it proceeds to the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (loop $chunks
+      ;; loop until EOF.
+      (br_if $chunks (i64.eq
+        (i64.shr_u
+          (call $read_body
+            (i32.const 0) ;; body_kind_request
+            (global.get $buf) (global.get $buf_limit))
+          (i64.const 32))
+        (i64.const 0))))
+
+    (return (i64.const 1)))
+
+  ;; handle_response adds each value of the "X-Checksum" request trailer to
+  ;; the "X-Checksum-Echo" response trailer.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (local $end i32)
+    (local $value i32)
+    (local $nul i32)
+
+    (local.set $end
+      (i32.add (global.get $buf)
+        (i32.wrap_i64
+          (call $get_header_values
+            (i32.const 2) ;; header_kind_request_trailers
+            (global.get $name) (global.get $name_len)
+            (global.get $buf) (global.get $buf_limit)))))
+
+    (local.set $value (global.get $buf))
+    (block $done
+      (loop $values
+        (br_if $done (i32.ge_u (local.get $value) (local.get $end)))
+
+        ;; find the NUL terminating the value.
+        (local.set $nul (local.get $value))
+        (loop $bytes
+          (if (i32.load8_u (local.get $nul))
+            (then
+              (local.set $nul (i32.add (local.get $nul) (i32.const 1)))
+              (br $bytes))))
+
+        (call $add_header_value
+          (i32.const 3) ;; header_kind_response_trailers
+          (global.get $echo_name) (global.get $echo_name_len)
+          (local.get $value) (i32.sub (local.get $nul) (local.get $value)))
+
+        (local.set $value (i32.add (local.get $nul) (i32.const 1)))
+        (br $values))))
+)
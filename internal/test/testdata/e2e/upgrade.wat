@@ -0,0 +1,75 @@
+(module $upgrade
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_header_values" (func $get_header_values
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "set_status_code" (func $set_status_code
+    (param $status_code i32)))
+
+  (import "http_handler" "get_status_code" (func $get_status_code
+    (result (; status_code ;) i32)))
+
+  (import "http_handler" "log" (func $log
+    (param $level i32)
+    (param $buf i32) (param $buf_limit i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $upgrade i32 (i32.const 0))
+  (data (i32.const 0) "Upgrade")
+  (global $upgrade_len i32 (i32.const 7))
+
+  ;; message is where log messages are formatted.
+  (global $message i32 (i32.const 16))
+
+  (global $buf i32 (i32.const 1024))
+  (global $buf_limit i32 (i32.const 1024))
+
+  ;; handle_request tries to enable buffering and logs the features enabled
+  ;; as a single digit. Then, it approves a WebSocket upgrade or rejects any
+  ;; other with status 403, and proceeds with any other request.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (i32.store8 (global.get $message)
+      (i32.add (i32.const 0x30) ;; '0'
+        (call $enable_features
+          (i32.const 3)))) ;; feature_buffer_request|feature_buffer_response
+    (call $log
+      (i32.const 0) ;; log_level_info
+      (global.get $message) (i32.const 1))
+
+    ;; proceed if there's no "Upgrade" header, or it starts with 'w' for
+    ;; "websocket".
+    (if (i64.eqz
+          (call $get_header_values
+            (i32.const 0) ;; header_kind_request
+            (global.get $upgrade) (global.get $upgrade_len)
+            (global.get $buf) (global.get $buf_limit)))
+      (then (return (i64.const 1))))
+    (if (i32.eq (i32.load8_u (global.get $buf)) (i32.const 0x77)) ;; 'w'
+      (then (return (i64.const 1))))
+
+    (call $set_status_code (i32.const 403))
+    (return (i64.const 0)))
+
+  ;; handle_response logs the status code as three digits.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (local $status_code i32)
+
+    (local.set $status_code (call $get_status_code))
+    (i32.store8 (global.get $message)
+      (i32.add (i32.const 0x30) (i32.div_u (local.get $status_code) (i32.const 100))))
+    (i32.store8 (i32.add (global.get $message) (i32.const 1))
+      (i32.add (i32.const 0x30) (i32.rem_u (i32.div_u (local.get $status_code) (i32.const 10)) (i32.const 10))))
+    (i32.store8 (i32.add (global.get $message) (i32.const 2))
+      (i32.add (i32.const 0x30) (i32.rem_u (local.get $status_code) (i32.const 10))))
+    (call $log
+      (i32.const 0) ;; log_level_info
+      (global.get $message) (i32.const 3)))
+)
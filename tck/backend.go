@@ -2,6 +2,7 @@ package tck
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -9,16 +10,18 @@ import (
 
 // BackendHandler is a http.Handler implementing the logic expected by the TCK.
 // It serves to echo back information from the request to the response for
-// checking expectations.
+// checking expectations, including the request body.
 func BackendHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("x-httpwasm-next-method", r.Method)
 		w.Header().Set("x-httpwasm-next-uri", r.RequestURI)
+		w.Header().Set("x-httpwasm-next-host", r.Host)
 		for k, vs := range r.Header {
 			for i, v := range vs {
 				w.Header().Add(fmt.Sprintf("x-httpwasm-next-header-%s-%d", k, i), v)
 			}
 		}
+		io.Copy(w, r.Body) // nolint
 	})
 }
 
@@ -1,5 +1,3 @@
 module github.com/anuraaga/http-wasm-tck/guest
 
-go 1.20
-
-require github.com/httpwasm/http-wasm-guest-tinygo v0.1.1
+go 1.24
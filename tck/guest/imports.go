@@ -0,0 +1,51 @@
+package main
+
+import "unsafe"
+
+// The guest SDK API, mirrored in internal/handler, doesn't expose these host
+// functions yet, so the TCK imports them directly. Memory offsets are uint32 as the guest is wasm32.
+
+//go:wasmimport http_handler get_scheme
+func getScheme(buf, bufLimit uint32) uint32
+
+//go:wasmimport http_handler get_authority
+func getAuthority(buf, bufLimit uint32) uint32
+
+//go:wasmimport http_handler set_authority
+func setAuthority(authority, authorityLen uint32)
+
+// readBody reads at most bufLimit bytes, unlike the SDK's body which reads
+// ahead. The result is 1<<32 at EOF, or'ed with the length read.
+//
+//go:wasmimport http_handler read_body
+func readBody(kind, buf, bufLimit uint32) uint64
+
+// buf is reused to read strings from the host.
+var buf = make([]byte, 2048)
+
+// getString returns the string a get function writes to memory, retrying
+// with a larger buffer if it doesn't fit.
+func getString(fn func(buf, bufLimit uint32) uint32) string {
+	size := fn(ptr(buf), uint32(len(buf)))
+	if size > uint32(len(buf)) {
+		buf = make([]byte, size)
+		size = fn(ptr(buf), size)
+	}
+	return string(buf[:size])
+}
+
+// ptr returns the memory offset of the slice, or zero if it is empty.
+func ptr(b []byte) uint32 {
+	if len(b) == 0 {
+		return 0
+	}
+	return uint32(uintptr(unsafe.Pointer(&b[0])))
+}
+
+// stringPtr returns the memory offset and length of the string.
+func stringPtr(s string) (uint32, uint32) {
+	if len(s) == 0 {
+		return 0, 0
+	}
+	return uint32(uintptr(unsafe.Pointer(unsafe.StringData(s)))), uint32(len(s))
+}
@@ -0,0 +1,76 @@
+// Package api is the subset of the TinyGo guest SDK API the TCK guest uses.
+// It mirrors github.com/http-wasm/http-wasm-guest-tinygo/handler/api, so
+// that the guest builds with standard Go without that dependency.
+package api
+
+import "io"
+
+// Features is a bit flag of host features, such as FeatureBufferRequest.
+type Features uint32
+
+const (
+	// FeatureBufferRequest buffers the request body, so that the next
+	// handler can read it after the guest.
+	FeatureBufferRequest Features = 1 << iota
+
+	// FeatureBufferResponse buffers the response, so that the guest can
+	// change it after the next handler.
+	FeatureBufferResponse
+
+	// FeatureTrailers allows reading and writing trailers.
+	FeatureTrailers
+)
+
+// Header is request or response headers or trailers.
+type Header interface {
+	// Names returns the header names, in lowercase.
+	Names() []string
+
+	// Get returns the first value of the header, and whether it exists.
+	Get(name string) (string, bool)
+
+	// GetAll returns all values of the header.
+	GetAll(name string) []string
+
+	// Set replaces any values of the header.
+	Set(name, value string)
+
+	// Add adds a value to the header.
+	Add(name, value string)
+
+	// Remove removes the header.
+	Remove(name string)
+}
+
+// Body is a request or response body.
+type Body interface {
+	// WriteTo writes the rest of the body to w, returning the size written.
+	WriteTo(w io.Writer) (int64, error)
+
+	// Write writes to the body, overwriting it on the first call.
+	Write([]byte)
+
+	// WriteString is like Write, but for a string.
+	WriteString(string)
+}
+
+// Request is the request being handled.
+type Request interface {
+	GetMethod() string
+	SetMethod(string)
+	GetURI() string
+	SetURI(string)
+	GetProtocolVersion() string
+	Headers() Header
+	Body() Body
+	Trailers() Header
+}
+
+// Response is the response being handled.
+type Response interface {
+	GetStatusCode() uint32
+	SetStatusCode(uint32)
+	Headers() Header
+	Body() Body
+	Trailers() Header
+}
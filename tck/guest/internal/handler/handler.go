@@ -0,0 +1,261 @@
+// Package handler is the subset of the TinyGo guest SDK the TCK guest uses.
+// It mirrors github.com/http-wasm/http-wasm-guest-tinygo/handler, so that
+// the guest builds with standard Go without that dependency.
+//
+// The guest is built as a WASI reactor, so the host initializes it with
+// "_initialize", and calls the exported "handle_request" and
+// "handle_response" functions.
+package handler
+
+import (
+	"io"
+	"runtime"
+	"unsafe"
+
+	"github.com/anuraaga/http-wasm-tck/guest/internal/handler/api"
+)
+
+//go:wasmimport http_handler enable_features
+func enableFeatures(features uint32) uint32
+
+//go:wasmimport http_handler get_method
+func getMethod(buf, bufLimit uint32) uint32
+
+//go:wasmimport http_handler set_method
+func setMethod(method, methodLen uint32)
+
+//go:wasmimport http_handler get_uri
+func getURI(buf, bufLimit uint32) uint32
+
+//go:wasmimport http_handler set_uri
+func setURI(uri, uriLen uint32)
+
+//go:wasmimport http_handler get_protocol_version
+func getProtocolVersion(buf, bufLimit uint32) uint32
+
+//go:wasmimport http_handler get_header_names
+func getHeaderNames(kind, buf, bufLimit uint32) uint64
+
+//go:wasmimport http_handler get_header_values
+func getHeaderValues(kind, name, nameLen, buf, bufLimit uint32) uint64
+
+//go:wasmimport http_handler set_header_value
+func setHeaderValue(kind, name, nameLen, value, valueLen uint32)
+
+//go:wasmimport http_handler add_header_value
+func addHeaderValue(kind, name, nameLen, value, valueLen uint32)
+
+//go:wasmimport http_handler remove_header
+func removeHeader(kind, name, nameLen uint32)
+
+//go:wasmimport http_handler read_body
+func readBody(kind, buf, bufLimit uint32) uint64
+
+//go:wasmimport http_handler write_body
+func writeBody(kind, body, bodyLen uint32)
+
+//go:wasmimport http_handler get_status_code
+func getStatusCode() uint32
+
+//go:wasmimport http_handler set_status_code
+func setStatusCode(statusCode uint32)
+
+// Header kinds, as defined by the host ABI.
+const (
+	headerKindRequest          = 0
+	headerKindResponse         = 1
+	headerKindRequestTrailers  = 2
+	headerKindResponseTrailers = 3
+)
+
+// Body kinds, as defined by the host ABI.
+const (
+	bodyKindRequest  = 0
+	bodyKindResponse = 1
+)
+
+// Host is the host the guest runs in.
+var Host host
+
+type host struct{}
+
+// EnableFeatures enables the features, returning all those the host supports.
+func (host) EnableFeatures(features api.Features) api.Features {
+	return api.Features(enableFeatures(uint32(features)))
+}
+
+// HandleRequestFn handles each request. The results are whether to proceed
+// to the next handler, and a context passed to HandleResponseFn.
+var HandleRequestFn = func(api.Request, api.Response) (next bool, reqCtx uint32) { return true, 0 }
+
+// HandleResponseFn handles each response after the next handler.
+var HandleResponseFn = func(uint32, api.Request, api.Response, bool) {}
+
+//go:wasmexport handle_request
+func handleRequest() uint64 {
+	next, reqCtx := HandleRequestFn(request{}, response{})
+	result := uint64(reqCtx) << 32
+	if next {
+		result |= 1
+	}
+	return result
+}
+
+//go:wasmexport handle_response
+func handleResponse(reqCtx, isError uint32) {
+	HandleResponseFn(reqCtx, request{}, response{}, isError == 1)
+}
+
+// buf is reused to read values from the host.
+var buf = make([]byte, 2048)
+
+// ptr returns the memory offset of the slice, or zero if it is empty.
+func ptr(b []byte) uint32 {
+	if len(b) == 0 {
+		return 0
+	}
+	return uint32(uintptr(unsafe.Pointer(&b[0])))
+}
+
+// stringPtr returns the memory offset and length of the string. Callers keep
+// the string alive until the host function returned.
+func stringPtr(s string) (uint32, uint32) {
+	if len(s) == 0 {
+		return 0, 0
+	}
+	return uint32(uintptr(unsafe.Pointer(unsafe.StringData(s)))), uint32(len(s))
+}
+
+// getString returns the string a get function writes to memory, retrying
+// with a larger buffer if it doesn't fit.
+func getString(fn func(buf, bufLimit uint32) uint32) string {
+	size := fn(ptr(buf), uint32(len(buf)))
+	if size > uint32(len(buf)) {
+		buf = make([]byte, size)
+		size = fn(ptr(buf), size)
+	}
+	return string(buf[:size])
+}
+
+// getStrings returns the NUL-terminated strings a get function writes to
+// memory, retrying with a larger buffer if they don't fit.
+func getStrings(fn func(buf, bufLimit uint32) uint64) []string {
+	countLen := fn(ptr(buf), uint32(len(buf)))
+	if size := uint32(countLen); size > uint32(len(buf)) {
+		buf = make([]byte, size)
+		countLen = fn(ptr(buf), size)
+	}
+	count, size := uint32(countLen>>32), uint32(countLen)
+	values := make([]string, 0, count)
+	start := uint32(0)
+	for i := uint32(0); i < size; i++ {
+		if buf[i] == 0 {
+			values = append(values, string(buf[start:i]))
+			start = i + 1
+		}
+	}
+	return values
+}
+
+type header uint32
+
+func (k header) Names() []string {
+	return getStrings(func(buf, bufLimit uint32) uint64 {
+		return getHeaderNames(uint32(k), buf, bufLimit)
+	})
+}
+
+func (k header) GetAll(name string) []string {
+	values := getStrings(func(buf, bufLimit uint32) uint64 {
+		n, nLen := stringPtr(name)
+		return getHeaderValues(uint32(k), n, nLen, buf, bufLimit)
+	})
+	runtime.KeepAlive(name)
+	return values
+}
+
+func (k header) Get(name string) (string, bool) {
+	if values := k.GetAll(name); len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+func (k header) Set(name, value string) {
+	n, nLen := stringPtr(name)
+	v, vLen := stringPtr(value)
+	setHeaderValue(uint32(k), n, nLen, v, vLen)
+	runtime.KeepAlive(name)
+	runtime.KeepAlive(value)
+}
+
+func (k header) Add(name, value string) {
+	n, nLen := stringPtr(name)
+	v, vLen := stringPtr(value)
+	addHeaderValue(uint32(k), n, nLen, v, vLen)
+	runtime.KeepAlive(name)
+	runtime.KeepAlive(value)
+}
+
+func (k header) Remove(name string) {
+	n, nLen := stringPtr(name)
+	removeHeader(uint32(k), n, nLen)
+	runtime.KeepAlive(name)
+}
+
+type body uint32
+
+func (k body) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		eofLen := readBody(uint32(k), ptr(buf), uint32(len(buf)))
+		n := uint32(eofLen)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		if eofLen>>32 == 1 { // EOF
+			return written, nil
+		}
+	}
+}
+
+func (k body) Write(b []byte) {
+	writeBody(uint32(k), ptr(b), uint32(len(b)))
+	runtime.KeepAlive(b)
+}
+
+func (k body) WriteString(s string) {
+	p, pLen := stringPtr(s)
+	writeBody(uint32(k), p, pLen)
+	runtime.KeepAlive(s)
+}
+
+type request struct{}
+
+func (request) GetMethod() string          { return getString(getMethod) }
+func (request) GetURI() string             { return getString(getURI) }
+func (request) GetProtocolVersion() string { return getString(getProtocolVersion) }
+func (request) Headers() api.Header        { return header(headerKindRequest) }
+func (request) Body() api.Body             { return body(bodyKindRequest) }
+func (request) Trailers() api.Header       { return header(headerKindRequestTrailers) }
+
+func (request) SetMethod(method string) {
+	setMethod(stringPtr(method))
+	runtime.KeepAlive(method)
+}
+
+func (request) SetURI(uri string) {
+	setURI(stringPtr(uri))
+	runtime.KeepAlive(uri)
+}
+
+type response struct{}
+
+func (response) GetStatusCode() uint32           { return getStatusCode() }
+func (response) SetStatusCode(statusCode uint32) { setStatusCode(statusCode) }
+func (response) Headers() api.Header             { return header(headerKindResponse) }
+func (response) Body() api.Body                  { return body(bodyKindResponse) }
+func (response) Trailers() api.Header            { return header(headerKindResponseTrailers) }
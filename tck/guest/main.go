@@ -5,19 +5,27 @@ import (
 	"fmt"
 	"strings"
 
-	httpwasm "github.com/httpwasm/http-wasm-guest-tinygo/handler"
-	"github.com/httpwasm/http-wasm-guest-tinygo/handler/api"
+	httpwasm "github.com/anuraaga/http-wasm-tck/guest/internal/handler"
+	"github.com/anuraaga/http-wasm-tck/guest/internal/handler/api"
 )
 
 // TODO: enable_features, get_header, set_header need to be tested separately.
 
-func main() {
+// main isn't called, as the guest is a WASI reactor: init runs instead when the
+// host initializes it.
+func main() {}
+
+func init() {
 	enabledFeatures := httpwasm.Host.EnableFeatures(api.FeatureBufferRequest | api.FeatureBufferResponse | api.FeatureTrailers)
 	h := handler{enabledFeatures: enabledFeatures}
 
 	httpwasm.HandleRequestFn = h.handleRequest
+	httpwasm.HandleResponseFn = h.handleResponse
 }
 
+// reqCtxResponseTrailers is the reqCtx of tests which set response trailers.
+const reqCtxResponseTrailers = 1
+
 type handler struct {
 	enabledFeatures api.Features
 }
@@ -70,6 +78,16 @@ func (h *handler) handleRequest(req api.Request, resp api.Response) (next bool,
 		next, reqCtx = h.testSetURI(req, resp, "/animal?name=panda")
 	case "set_uri/query/escaping":
 		next, reqCtx = h.testSetURI(req, resp, "/disney?name=chip%26dale")
+	case "get_scheme":
+		// The test runner compares this with the request value.
+		resp.Body().WriteString(getString(getScheme))
+	case "get_authority":
+		// The test runner compares this with the request value.
+		resp.Body().WriteString(getString(getAuthority))
+	case "set_authority":
+		next, reqCtx = h.testSetAuthority(req, resp, "example.com:8080")
+	case "set_header_value/request/host":
+		next, reqCtx = h.testSetRequestHeader(req, resp, "Host", "example.com:8080")
 	case "get_header_values/request/lowercase-key":
 		next, reqCtx = h.testGetRequestHeader(req, resp, "single-header", []string{"value"})
 	case "get_header_values/request/mixedcase-key":
@@ -102,6 +120,16 @@ func (h *handler) handleRequest(req api.Request, resp api.Response) (next bool,
 		next, reqCtx = h.testReadBody(req, resp, strings.Repeat("a", 4096))
 	case "read_body/request/xlarge":
 		next, reqCtx = h.testReadBody(req, resp, strings.Repeat("a", 5000))
+	case "trailers/request":
+		next, reqCtx = h.testRequestTrailers(req, resp, "x-checksum", []string{"a", "b"})
+	case "trailers/response":
+		next, reqCtx = true, reqCtxResponseTrailers
+	case "read_body/request/replay/zero":
+		next, reqCtx = h.testReadBodyReplay(resp, 0)
+	case "read_body/request/replay/partial":
+		next, reqCtx = h.testReadBodyReplay(resp, 5)
+	case "read_body/request/replay/full":
+		next, reqCtx = h.testReadBodyReplay(resp, len(replayBody))
 	default:
 		fail(resp, "unknown x-httpwasm-test-id")
 	}
@@ -135,6 +163,11 @@ func (h *handler) testSetURI(req api.Request, _ api.Response, uri string) (next
 	return true, 0
 }
 
+func (h *handler) testSetAuthority(_ api.Request, _ api.Response, authority string) (next bool, reqCtx uint32) {
+	setAuthority(stringPtr(authority))
+	return true, 0
+}
+
 func (h *handler) testGetRequestHeader(req api.Request, resp api.Response, header string, expectedValue []string) (next bool, reqCtx uint32) {
 	have := req.Headers().GetAll(header)
 	if len(have) != len(expectedValue) {
@@ -212,6 +245,62 @@ func (h *handler) testReadBody(req api.Request, resp api.Response, expectedBody
 	return
 }
 
+// handleResponse sets response trailers for the tests that need them, after
+// the next handler, which are sent after the response body.
+func (h *handler) handleResponse(reqCtx uint32, _ api.Request, resp api.Response, isError bool) {
+	if isError || reqCtx != reqCtxResponseTrailers {
+		return
+	}
+	resp.Trailers().Add("x-checksum-echo", "a")
+	resp.Trailers().Add("x-checksum-echo", "b")
+}
+
+// testRequestTrailers reads the request body to the end, so that its
+// trailers arrived, then checks them before proceeding to the next handler.
+func (h *handler) testRequestTrailers(req api.Request, resp api.Response, trailer string, expectedValue []string) (next bool, reqCtx uint32) {
+	if _, err := req.Body().WriteTo(&bytes.Buffer{}); err != nil {
+		fail(resp, fmt.Sprintf("trailers/request: error %v", err))
+		return
+	}
+
+	have := req.Trailers().GetAll(trailer)
+	if len(have) != len(expectedValue) {
+		fail(resp, fmt.Sprintf("trailers/request: want %d values, have %d", len(expectedValue), len(have)))
+		return
+	}
+	for i, v := range have {
+		if v != expectedValue[i] {
+			fail(resp, fmt.Sprintf("trailers/request: want %s, have %s", expectedValue[i], v))
+			return
+		}
+	}
+	return true, 0
+}
+
+// replayBody is the request body of read_body/request/replay tests.
+var replayBody = strings.Repeat("abcdefgh", 625)
+
+// testReadBodyReplay reads the first n bytes of the request body, then
+// proceeds to the next handler, which echoes it. The runner expects the
+// whole body, as the host buffers it.
+func (h *handler) testReadBodyReplay(resp api.Response, n int) (next bool, reqCtx uint32) {
+	b := make([]byte, n)
+	read := 0
+	for read < n {
+		result := readBody(0, ptr(b[read:]), uint32(n-read)) // body_kind_request
+		read += int(uint32(result))
+		if result>>32 == 1 { // EOF
+			break
+		}
+	}
+
+	if have := string(b[:read]); have != replayBody[:n] {
+		fail(resp, fmt.Sprintf("read_body/request/replay: want %s, have %s", replayBody[:n], have))
+		return
+	}
+	return true, 0
+}
+
 func fail(resp api.Response, msg string) {
 	resp.SetStatusCode(500)
 	resp.Headers().Set("x-httpwasm-tck-failed", msg)
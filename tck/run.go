@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -47,12 +48,17 @@ func Run(t *testing.T, client *http.Client, url string) {
 	r.testSetMethod()
 	r.testGetURI()
 	r.testSetURI()
+	r.testGetScheme()
+	r.testGetAuthority()
+	r.testSetAuthority()
 	r.testGetHeaderValuesRequest()
 	r.testGetRequestHeaderNamesRequest()
 	r.testSetHeaderValueRequest()
 	r.testAddHeaderValueRequest()
 	r.testRemoveHeaderRequest()
 	r.testReadBodyRequest()
+	r.testReadBodyRequestReplay()
+	r.testTrailers()
 }
 
 type testRunner struct {
@@ -228,6 +234,88 @@ func (r *testRunner) testSetURI() {
 	}
 }
 
+func (r *testRunner) testGetScheme() {
+	hostFn := handler.FuncGetScheme
+
+	testID := hostFn
+	r.t.Run(testID, func(t *testing.T) {
+		req, err := http.NewRequest("GET", r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("x-httpwasm-tck-testid", testID)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := checkResponse(t, resp)
+
+		// Requests are in origin-form, so the scheme is that of the URL.
+		if want, have := req.URL.Scheme, body; want != have {
+			t.Errorf("expected scheme to be %s, have %s", want, have)
+		}
+	})
+}
+
+func (r *testRunner) testGetAuthority() {
+	hostFn := handler.FuncGetAuthority
+
+	testID := hostFn
+	r.t.Run(testID, func(t *testing.T) {
+		req, err := http.NewRequest("GET", r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("x-httpwasm-tck-testid", testID)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := checkResponse(t, resp)
+
+		// This is the "Host" header in HTTP/1.1 and the ":authority"
+		// pseudo-header in HTTP/2.
+		if want, have := req.URL.Host, body; want != have {
+			t.Errorf("expected authority to be %s, have %s", want, have)
+		}
+	})
+}
+
+// testSetAuthority ensures the authority the next handler sees changes,
+// whether set directly or via the "Host" request header.
+func (r *testRunner) testSetAuthority() {
+	tests := []string{
+		handler.FuncSetAuthority,
+		handler.FuncSetHeaderValue + "/request/host",
+	}
+
+	for _, testID := range tests {
+		testID := testID
+		r.t.Run(testID, func(t *testing.T) {
+			req, err := http.NewRequest("GET", r.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("x-httpwasm-tck-testid", testID)
+			resp, err := r.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkResponse(t, resp)
+
+			if want, have := "example.com:8080", resp.Header.Get("x-httpwasm-next-host"); want != have {
+				t.Errorf("expected authority to be %s, have %s", want, have)
+			}
+		})
+	}
+}
+
 func (r *testRunner) testGetHeaderValuesRequest() {
 	hostFn := handler.FuncGetHeaderValues
 
@@ -355,6 +443,67 @@ func (r *testRunner) testReadBodyRequest() {
 	}
 }
 
+// testReadBodyRequestReplay ensures the next handler receives the whole
+// request body, regardless of how much of it the guest read, as the TCK guest
+// enables handler.FeatureBufferRequest.
+func (r *testRunner) testReadBodyRequestReplay() {
+	hostFn := handler.FuncReadBody
+
+	// The body spans multiple reads, and isn't uniform to show the order.
+	payload := strings.Repeat("abcdefgh", 625)
+
+	for _, tc := range []string{"zero", "partial", "full"} {
+		testID := fmt.Sprintf("%s/request/replay/%s", hostFn, tc)
+		r.t.Run(testID, func(t *testing.T) {
+			req, err := http.NewRequest("POST", r.url, strings.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("x-httpwasm-tck-testid", testID)
+			resp, err := r.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if body := checkResponse(t, resp); body != payload {
+				t.Errorf("unexpected body echoed by next, want %d bytes, have %d: %q", len(payload), len(body), body)
+			}
+		})
+	}
+}
+
+// testTrailers ensures the guest can read request trailers and set response
+// trailers. The request body has an unknown length, so that HTTP/1.1 uses
+// chunked encoding, which is required for trailers.
+func (r *testRunner) testTrailers() {
+	for _, kind := range []string{"request", "response"} {
+		testID := "trailers/" + kind
+		r.t.Run(testID, func(t *testing.T) {
+			req, err := http.NewRequest("POST", r.url, io.NopCloser(strings.NewReader("request")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = -1
+			req.Trailer = http.Header{"X-Checksum": {"a", "b"}}
+
+			req.Header.Set("x-httpwasm-tck-testid", testID)
+			resp, err := r.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkResponse(t, resp) // trailers are read after the body
+			if kind != "response" {
+				return
+			}
+			if want, have := []string{"a", "b"}, resp.Trailer.Values("X-Checksum-Echo"); !reflect.DeepEqual(want, have) {
+				t.Errorf("unexpected response trailer, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
 func (r *testRunner) testSetHeaderValueRequest() {
 	hostFn := handler.FuncSetHeaderValue
 
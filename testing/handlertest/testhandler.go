@@ -8,6 +8,8 @@ package handlertest
 import (
 	"context"
 	"errors"
+	"io"
+	"net/http"
 	"reflect"
 	"sort"
 	"strings"
@@ -41,6 +43,9 @@ func HostTest(t *testing.T, h handler.Host, newCtx func(handler.Features) (conte
 
 	ht.testMethod()
 	ht.testURI()
+	ht.testQuery()
+	ht.testScheme()
+	ht.testAuthority()
 	ht.testProtocolVersion()
 	ht.testRequestHeaders()
 	ht.testRequestBody()
@@ -49,6 +54,9 @@ func HostTest(t *testing.T, h handler.Host, newCtx func(handler.Features) (conte
 	ht.testResponseHeaders()
 	ht.testResponseBody()
 	ht.testResponseTrailers()
+	ht.testRequestCookies()
+	ht.testResponseCookies()
+	ht.testTLS()
 
 	if len(ht.errText) == 0 {
 		return nil
@@ -136,6 +144,176 @@ func (h *hostTester) testURI() {
 	})
 }
 
+func (h *hostTester) testQuery() {
+	ctx, _ := h.newCtx(0) // no features required
+
+	h.t.Run("GetQueryNames default", func(t *testing.T) {
+		if h.h.GetQueryNames(ctx) != nil {
+			t.Errorf("unexpected default query names, want: nil")
+		}
+	})
+
+	h.t.Run("GetQueryNames", func(t *testing.T) {
+		h.h.SetURI(ctx, "/animal?name=panda&tag=a&tag=b&empty=")
+
+		want := []string{"empty", "name", "tag"}
+		have := h.h.GetQueryNames(ctx)
+		sort.Strings(have)
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected query names, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("GetQueryValues", func(t *testing.T) {
+		h.h.SetURI(ctx, "/disney?name=chip%26dale&tag=a&tag=b&empty=")
+
+		tests := []struct {
+			name string
+			want []string
+		}{
+			{name: "name", want: []string{"chip&dale"}},
+			{name: "tag", want: []string{"a", "b"}},
+			{name: "empty", want: []string{""}},
+			{name: "not found"},
+		}
+		for _, tc := range tests {
+			if have := h.h.GetQueryValues(ctx, tc.name); !reflect.DeepEqual(tc.want, have) {
+				t.Errorf("%s: unexpected query values, want: %v, have: %v", tc.name, tc.want, have)
+			}
+		}
+	})
+
+	tests := []struct {
+		name string
+		fn   func(ctx context.Context)
+		want string
+	}{
+		{
+			name: "SetQueryValue non-existing",
+			fn:   func(ctx context.Context) { h.h.SetQueryValue(ctx, "new", "1") },
+			want: "/animal?name=panda&new=1&tag=a&tag=b",
+		},
+		{
+			name: "SetQueryValue existing",
+			fn:   func(ctx context.Context) { h.h.SetQueryValue(ctx, "tag", "c") },
+			want: "/animal?name=panda&tag=c",
+		},
+		{
+			name: "SetQueryValue escaping",
+			fn:   func(ctx context.Context) { h.h.SetQueryValue(ctx, "name", "chip&dale go") },
+			want: "/animal?name=chip%26dale+go&tag=a&tag=b",
+		},
+		{
+			name: "AddQueryValue non-existing",
+			fn:   func(ctx context.Context) { h.h.AddQueryValue(ctx, "new", "") },
+			want: "/animal?name=panda&new=&tag=a&tag=b",
+		},
+		{
+			name: "AddQueryValue existing",
+			fn:   func(ctx context.Context) { h.h.AddQueryValue(ctx, "tag", "c") },
+			want: "/animal?name=panda&tag=a&tag=b&tag=c",
+		},
+		{
+			name: "RemoveQuery non-existing",
+			fn:   func(ctx context.Context) { h.h.RemoveQuery(ctx, "new") },
+			want: "/animal?name=panda&tag=a&tag=b",
+		},
+		{
+			name: "RemoveQuery existing",
+			fn:   func(ctx context.Context) { h.h.RemoveQuery(ctx, "tag") },
+			want: "/animal?name=panda",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		h.t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := h.newCtx(0) // no features required
+			h.h.SetURI(ctx, "/animal?name=panda&tag=a&tag=b")
+
+			tc.fn(ctx)
+
+			if have := h.h.GetURI(ctx); tc.want != have {
+				t.Errorf("unexpected URI, want: %v, have: %v", tc.want, have)
+			}
+		})
+	}
+
+	h.t.Run("RemoveQuery last", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+		h.h.SetURI(ctx, "/animal?name=panda")
+
+		h.h.RemoveQuery(ctx, "name")
+
+		if want, have := "/animal", h.h.GetURI(ctx); want != have {
+			t.Errorf("unexpected URI, want: %v, have: %v", want, have)
+		}
+	})
+}
+
+func (h *hostTester) testScheme() {
+	ctx, _ := h.newCtx(0) // no features required
+
+	h.t.Run("GetScheme default", func(t *testing.T) {
+		if want, have := "http", h.h.GetScheme(ctx); want != have {
+			t.Errorf("unexpected default scheme, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("SetScheme", func(t *testing.T) {
+		for _, want := range []string{"https", "http"} {
+			h.h.SetScheme(ctx, want)
+
+			if have := h.h.GetScheme(ctx); want != have {
+				t.Errorf("unexpected scheme, set: %v, have: %v", want, have)
+			}
+		}
+	})
+}
+
+// testAuthority ensures the authority and the "Host" request header are
+// consistent, regardless of which is changed.
+func (h *hostTester) testAuthority() {
+	ctx, _ := h.newCtx(0) // no features required
+
+	requireAuthority := func(t *testing.T, want string) {
+		if have := h.h.GetAuthority(ctx); want != have {
+			t.Errorf("unexpected authority, want: %v, have: %v", want, have)
+		}
+		var wantValues []string
+		if want != "" {
+			wantValues = []string{want}
+		}
+		if have := h.h.GetRequestHeaderValues(ctx, "Host"); !reflect.DeepEqual(wantValues, have) {
+			t.Errorf("unexpected host header, want: %v, have: %v", wantValues, have)
+		}
+	}
+
+	h.t.Run("SetAuthority", func(t *testing.T) {
+		for _, want := range []string{"example.com", "example.com:8080", ""} {
+			h.h.SetAuthority(ctx, want)
+			requireAuthority(t, want)
+		}
+	})
+
+	h.t.Run("SetRequestHeaderValue Host", func(t *testing.T) {
+		for _, want := range []string{"example.com", "example.com:8080"} {
+			h.h.SetRequestHeaderValue(ctx, "host", want)
+			requireAuthority(t, want)
+		}
+	})
+
+	h.t.Run("AddRequestHeaderValue Host", func(t *testing.T) {
+		h.h.AddRequestHeaderValue(ctx, "Host", "example.com")
+		requireAuthority(t, "example.com") // host can't have multiple values
+	})
+
+	h.t.Run("RemoveRequestHeader Host", func(t *testing.T) {
+		h.h.RemoveRequestHeader(ctx, "Host")
+		requireAuthority(t, "")
+	})
+}
+
 func (h *hostTester) testProtocolVersion() {
 	ctx, _ := h.newCtx(0) // no features required
 
@@ -385,6 +563,35 @@ func (h *hostTester) testRequestBody() {
 			t.Errorf("unexpected default body reader, want: != nil")
 		}
 	})
+
+	h.t.Run("RequestBodyReader reads a rewritten body", func(t *testing.T) {
+		ctx, _ := h.newCtx(handler.FeatureBufferRequest)
+		if _, err := h.h.RequestBodyWriter(ctx).Write([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+
+		r := h.h.RequestBodyReader(ctx)
+		defer r.Close()
+
+		// A zero-length read shouldn't consume anything.
+		if n, err := r.Read(nil); n != 0 || err != nil {
+			t.Errorf("unexpected zero-length read, want: 0, <nil>, have: %d, %v", n, err)
+		}
+
+		// A partial read should leave the rest for the next read.
+		partial := make([]byte, 5)
+		if n, err := io.ReadFull(r, partial); err != nil {
+			t.Fatal(err)
+		} else if want, have := "hello", string(partial[:n]); want != have {
+			t.Errorf("unexpected partial read, want: %q, have: %q", want, have)
+		}
+
+		if rest, err := io.ReadAll(r); err != nil {
+			t.Fatal(err)
+		} else if want, have := " world", string(rest); want != have {
+			t.Errorf("unexpected full read, want: %q, have: %q", want, have)
+		}
+	})
 }
 
 func (h *hostTester) testRequestTrailers() {
@@ -398,6 +605,43 @@ func (h *hostTester) testRequestTrailers() {
 			t.Errorf("unexpected default trailer names, want: nil")
 		}
 	})
+
+	h.t.Run("request trailers", func(t *testing.T) {
+		h.testTrailers(t, ctx, h.h.GetRequestTrailerNames, h.h.GetRequestTrailerValues,
+			h.h.SetRequestTrailerValue, h.h.AddRequestTrailerValue, h.h.RemoveRequestTrailer)
+	})
+}
+
+// testTrailers tests functions of request or response trailers, which are
+// expected to have none initially.
+func (h *hostTester) testTrailers(
+	t *testing.T,
+	ctx context.Context,
+	getNames func(context.Context) []string,
+	getValues func(context.Context, string) []string,
+	setValue, addValue func(context.Context, string, string),
+	remove func(context.Context, string),
+) {
+	setValue(ctx, "Grpc-Status", "1")
+	setValue(ctx, "Grpc-Status", "0") // replaces
+	addValue(ctx, "X-Checksum", "a")
+	addValue(ctx, "x-checksum", "b") // appends, case-insensitive
+
+	if want, have := []string{"Grpc-Status", "X-Checksum"}, getNames(ctx); !reflect.DeepEqual(want, have) {
+		t.Errorf("unexpected trailer names, want: %v, have: %v", want, have)
+	}
+	if want, have := []string{"0"}, getValues(ctx, "grpc-status"); !reflect.DeepEqual(want, have) {
+		t.Errorf("unexpected set trailer values, want: %v, have: %v", want, have)
+	}
+	if want, have := []string{"a", "b"}, getValues(ctx, "X-Checksum"); !reflect.DeepEqual(want, have) {
+		t.Errorf("unexpected added trailer values, want: %v, have: %v", want, have)
+	}
+
+	remove(ctx, "Grpc-Status")
+	remove(ctx, "X-Checksum")
+	if have := getNames(ctx); have != nil {
+		t.Errorf("unexpected trailer names after remove, want: nil, have: %v", have)
+	}
 }
 
 func (h *hostTester) testStatusCode() {
@@ -673,6 +917,134 @@ func (h *hostTester) testResponseTrailers() {
 			t.Errorf("unexpected default trailer names, want: nil")
 		}
 	})
+
+	h.t.Run("response trailers", func(t *testing.T) {
+		h.testTrailers(t, ctx, h.h.GetResponseTrailerNames, h.h.GetResponseTrailerValues,
+			h.h.SetResponseTrailerValue, h.h.AddResponseTrailerValue, h.h.RemoveResponseTrailer)
+	})
+}
+
+func (h *hostTester) testRequestCookies() {
+	ctx, _ := h.newCtx(0) // no features required
+
+	h.t.Run("GetRequestCookieNames default", func(t *testing.T) {
+		if h.h.GetRequestCookieNames(ctx) != nil {
+			t.Errorf("unexpected default cookie names, want: nil")
+		}
+	})
+
+	h.h.SetRequestHeaderValue(ctx, "Cookie", "a=1; b=2")
+	h.h.AddRequestHeaderValue(ctx, "Cookie", "a=3; c=")
+
+	h.t.Run("GetRequestCookieNames", func(t *testing.T) {
+		want := []string{"a", "b", "c"}
+		have := h.h.GetRequestCookieNames(ctx)
+		sort.Strings(have)
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected cookie names, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("GetRequestCookieValues", func(t *testing.T) {
+		tests := []struct {
+			name string
+			want []string
+		}{
+			{name: "a", want: []string{"1", "3"}},
+			{name: "b", want: []string{"2"}},
+			{name: "c", want: []string{""}},
+			{name: "d"},
+		}
+		for _, tc := range tests {
+			if have := h.h.GetRequestCookieValues(ctx, tc.name); !reflect.DeepEqual(tc.want, have) {
+				t.Errorf("%s: unexpected cookie values, want: %v, have: %v", tc.name, tc.want, have)
+			}
+		}
+	})
+}
+
+func (h *hostTester) testResponseCookies() {
+	// responseCookies parses the "Set-Cookie" response headers.
+	responseCookies := func(ctx context.Context) []*http.Cookie {
+		header := http.Header{"Set-Cookie": h.h.GetResponseHeaderValues(ctx, "Set-Cookie")}
+		return (&http.Response{Header: header}).Cookies()
+	}
+
+	h.t.Run("SetResponseCookie", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+
+		h.h.SetResponseCookie(ctx, handler.Cookie{
+			Name:   "session",
+			Value:  "1",
+			Path:   "/",
+			Domain: "example.com",
+			MaxAge: 60,
+			Flags:  handler.CookieFlagSecure | handler.CookieFlagHttpOnly | handler.CookieFlagSameSiteStrict,
+		})
+
+		cookies := responseCookies(ctx)
+		if len(cookies) != 1 {
+			t.Fatalf("unexpected cookies: %v", cookies)
+		}
+		c := cookies[0]
+		if c.Name != "session" || c.Value != "1" || c.Path != "/" || c.Domain != "example.com" ||
+			c.MaxAge != 60 || !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteStrictMode {
+			t.Errorf("unexpected cookie: %v", c)
+		}
+	})
+
+	h.t.Run("SetResponseCookie replaces", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+
+		h.h.SetResponseCookie(ctx, handler.Cookie{Name: "a", Value: "1"})
+		h.h.SetResponseCookie(ctx, handler.Cookie{Name: "b", Value: "2"})
+		h.h.SetResponseCookie(ctx, handler.Cookie{Name: "a", Value: "3"})
+		h.h.SetResponseCookie(ctx, handler.Cookie{Name: "a", Value: "4", Path: "/a"})
+
+		var have []string
+		for _, c := range responseCookies(ctx) {
+			have = append(have, c.Name+"="+c.Value+";"+c.Path)
+		}
+		if want := []string{"b=2;", "a=3;", "a=4;/a"}; !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected cookies, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("DeleteResponseCookie", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+
+		h.h.SetResponseCookie(ctx, handler.Cookie{Name: "a", Value: "1", Path: "/"})
+		h.h.DeleteResponseCookie(ctx, "a", "/", "")
+
+		cookies := responseCookies(ctx)
+		if len(cookies) != 1 {
+			t.Fatalf("unexpected cookies: %v", cookies)
+		}
+		if c := cookies[0]; c.Name != "a" || c.Path != "/" || c.MaxAge >= 0 {
+			t.Errorf("expected cookie to be deleted: %v", c)
+		}
+	})
+}
+
+func (h *hostTester) testTLS() {
+	ctx, _ := h.newCtx(0) // no features required
+
+	// The request in the context isn't over TLS.
+	h.t.Run("TLS default", func(t *testing.T) {
+		for name, fn := range map[string]func(context.Context) string{
+			"GetTLSVersion":     h.h.GetTLSVersion,
+			"GetTLSCipherSuite": h.h.GetTLSCipherSuite,
+			"GetTLSServerName":  h.h.GetTLSServerName,
+			"GetTLSPeerSubject": h.h.GetTLSPeerSubject,
+		} {
+			if have := fn(ctx); have != "" {
+				t.Errorf("unexpected default %s, want: \"\", have: %v", name, have)
+			}
+		}
+		if h.h.GetTLSPeerSANs(ctx) != nil {
+			t.Errorf("unexpected default TLS peer SANs, want: nil")
+		}
+	})
 }
 
 // Note: senders are supposed to concatenate multiple fields with the same